@@ -0,0 +1,179 @@
+package stream
+
+import (
+	"fmt"
+	"sync"
+)
+
+// AsyncStream runs terminal operations on a new goroutine, each of them
+// returns a Future immediately
+type AsyncStream interface {
+	// ForEach calls forEach on every element, result of Future is nil
+	ForEach(forEach ForEachFunc) *Future
+	// Collect transforms stream to array, result of Future is []interface{}
+	Collect() *Future
+	// Count counts elements in stream, result of Future is int
+	Count() *Future
+	// Max finds the maximum element use comparator, result of Future is the element
+	Max(comparator ComparatorFunc) *Future
+	// Min finds the minimal element use comparator, result of Future is the element
+	Min(comparator ComparatorFunc) *Future
+	// First finds the first element in stream, result of Future is the element or nil
+	First() *Future
+	// Last finds the last element in stream, result of Future is the element or nil
+	Last() *Future
+	// Reduce uses into to collect elements to out, result of Future is out
+	Reduce(into ReduceFunc, out interface{}) *Future
+}
+
+// Future is the handle of a stream running on another goroutine
+type Future struct {
+	start      *startOp
+	done       chan struct{}
+	cancelled  chan struct{}
+	cancelOnce sync.Once
+	result     interface{}
+	err        error
+}
+
+func newFuture(start *startOp) *Future {
+	return &Future{start: start, done: make(chan struct{}), cancelled: make(chan struct{})}
+}
+
+// run calls fn on a new goroutine, and completes Future with its result
+// and the error of stream, a panic of fn is reported as error
+func (f *Future) run(fn func() interface{}) {
+	go func() {
+		defer close(f.done)
+		defer func() {
+			if r := recover(); r != nil {
+				f.err = fmt.Errorf("stream panicked: %v", r)
+			}
+		}()
+		f.result = fn()
+		f.err = f.start.getErr()
+	}()
+}
+
+// Wait blocks until the stream is done, and returns the result of terminal operation
+// and the first error occurred, ErrCancelled is returned if the stream is cancelled
+func (f *Future) Wait() (interface{}, error) {
+	<-f.done
+	return f.result, f.err
+}
+
+// Done returns a channel which is closed when the stream is done
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err blocks until the stream is done, and returns the first error occurred
+func (f *Future) Err() error {
+	<-f.done
+	return f.err
+}
+
+// Cancel requests the stream to stop, it does not wait for the stream to finish.
+// Stages already processing an element may finish it before stopping, but stages
+// buffering data such as Sort, Group and Distinct do not pass it on
+func (f *Future) Cancel() {
+	f.cancelOnce.Do(func() {
+		f.start.cancel()
+		close(f.cancelled)
+	})
+}
+
+type asyncStream struct {
+	b *baseStage
+}
+
+func (a asyncStream) ForEach(forEach ForEachFunc) *Future {
+	f := newFuture(a.b.startStage)
+	f.run(func() interface{} {
+		a.b.ForEach(forEach)
+		return nil
+	})
+	return f
+}
+
+func (a asyncStream) Collect() *Future {
+	f := newFuture(a.b.startStage)
+	f.run(func() interface{} {
+		return a.b.Collect()
+	})
+	return f
+}
+
+func (a asyncStream) Count() *Future {
+	f := newFuture(a.b.startStage)
+	f.run(func() interface{} {
+		return a.b.Count()
+	})
+	return f
+}
+
+func (a asyncStream) Max(comparator ComparatorFunc) *Future {
+	f := newFuture(a.b.startStage)
+	f.run(func() interface{} {
+		return a.b.Max(comparator)
+	})
+	return f
+}
+
+func (a asyncStream) Min(comparator ComparatorFunc) *Future {
+	f := newFuture(a.b.startStage)
+	f.run(func() interface{} {
+		return a.b.Min(comparator)
+	})
+	return f
+}
+
+func (a asyncStream) First() *Future {
+	f := newFuture(a.b.startStage)
+	f.run(func() interface{} {
+		return a.b.First()
+	})
+	return f
+}
+
+func (a asyncStream) Last() *Future {
+	f := newFuture(a.b.startStage)
+	f.run(func() interface{} {
+		return a.b.Last()
+	})
+	return f
+}
+
+func (a asyncStream) Reduce(into ReduceFunc, out interface{}) *Future {
+	f := newFuture(a.b.startStage)
+	f.run(func() interface{} {
+		if err := a.b.Reduce(into, out); err != nil {
+			a.b.fail(err)
+		}
+		return out
+	})
+	return f
+}
+
+// channelOp sends elements to a channel, it stops once Future is cancelled
+type channelOp struct {
+	terminalOp
+	ch        chan<- interface{}
+	cancelled <-chan struct{}
+}
+
+func (c *channelOp) accept(t interface{}) {
+	select {
+	case c.ch <- t:
+	case <-c.cancelled:
+	}
+}
+
+func (c *channelOp) cancellationRequested() bool {
+	select {
+	case <-c.cancelled:
+		return true
+	default:
+		return false
+	}
+}
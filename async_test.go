@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"testing"
+)
+
+func TestToChannel(t *testing.T) {
+	ch, f := New(dataGenerator()).Filter(func(v interface{}) bool {
+		return v.(int)%2 == 0
+	}).ToChannel(4)
+	count := 0
+	for range ch {
+		count++
+	}
+	if count != 100 || f.Err() != nil {
+		t.Fatalf("expect 100 elements, got %d, err %v", count, f.Err())
+	}
+
+	ch, f = New(dataGenerator()).ToChannel(0)
+	<-ch
+	f.Cancel()
+	if _, err := f.Wait(); err != ErrCancelled {
+		t.Fatalf("expect ErrCancelled, got %v", err)
+	}
+	for range ch { // channel is closed after cancellation
+	}
+}
+
+func TestAsync(t *testing.T) {
+	res, err := New(dataGenerator()).Async().Count().Wait()
+	if err != nil || res.(int) != 200 {
+		t.Fatalf("expect 200, got %v, err %v", res, err)
+	}
+
+	var out []int
+	res, err = Of(1, 2).Async().Reduce(ToList(), &out).Wait()
+	if err != nil || len(*res.(*[]int)) != 2 {
+		t.Fatalf("unexpected result %v, err %v", res, err)
+	}
+
+	release := make(chan struct{})
+	f := New(dataGenerator()).Async().ForEach(func(v interface{}) {
+		<-release
+	})
+	f.Cancel()
+	close(release)
+	if err = f.Err(); err != ErrCancelled {
+		t.Fatalf("expect ErrCancelled, got %v", err)
+	}
+
+	_, err = Of(1).Map(func(v interface{}) interface{} {
+		panic("boom")
+	}).Async().Collect().Wait()
+	if err == nil {
+		t.Fatal("expect panic reported as error")
+	}
+}
+
+func TestCancelStopsBufferedStages(t *testing.T) {
+	reached, resume := make(chan struct{}), make(chan struct{})
+	gate := func(v interface{}) interface{} {
+		if v == 1 {
+			close(reached)
+			<-resume
+		}
+		return v
+	}
+	identity := func(v interface{}) interface{} { return v }
+	stages := map[string]func(Stream) Stream{
+		"sort":     func(s Stream) Stream { return s.Sort(intComparator) },
+		"distinct": func(s Stream) Stream { return s.Distinct() },
+		"group":    func(s Stream) Stream { return s.Group(identity) },
+		"fallback": func(s Stream) Stream {
+			return s.OnErrorReturn(func(err error) interface{} { return -1 }).Sort(intComparator)
+		},
+	}
+	for name, stage := range stages {
+		reached, resume = make(chan struct{}), make(chan struct{})
+		f := stage(Of(5, 3, 1, 4, 2).Map(gate)).Map(identity).Async().Collect()
+		<-reached
+		f.Cancel()
+		close(resume)
+		res, err := f.Wait()
+		if err != ErrCancelled || len(res.([]interface{})) != 0 {
+			t.Fatalf("%s: expect nothing passed after cancel, got %v, err %v", name, res, err)
+		}
+	}
+}
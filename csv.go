@@ -0,0 +1,259 @@
+package stream
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CSVOptions configures FromCSV and ToCSV
+type CSVOptions struct {
+	// Comma is the field delimiter, ',' is used if it is zero
+	Comma rune
+	// Header indicates that the first record is a header row. FromCSV reads it to map
+	// columns to struct fields, ToCSV writes it before the first element
+	Header bool
+	// Prototype makes FromCSV emit values of the same type as Prototype instead of
+	// []string, it should be a struct or a pointer to struct. Columns are mapped to
+	// fields by the csv tag or the field name, or by field order if there is no header
+	Prototype interface{}
+	// Columns decides which columns ToCSV writes and their order, by default all the
+	// fields of struct elements, or all the sorted keys of the first map element are written
+	Columns []string
+}
+
+const csvTag = "csv"
+
+func (o CSVOptions) comma() rune {
+	if o.Comma == 0 {
+		return ','
+	}
+	return o.Comma
+}
+
+type csvSource struct {
+	reader   *csv.Reader
+	opts     CSVOptions
+	typ      reflect.Type
+	fields   [][]int // index of field for each column, nil if column is not mapped
+	started  bool
+	index    int // count of records read, header excluded
+	readErr  error
+	finished bool
+}
+
+func (c *csvSource) size() int {
+	return 0
+}
+
+func (c *csvSource) characteristics() Characteristics {
+	return Ordered | NonNull
+}
+
+func (c *csvSource) read() ([]string, bool) {
+	record, err := c.reader.Read()
+	if err == io.EOF {
+		return nil, false
+	}
+	if err != nil {
+		c.readErr = err
+		return nil, false
+	}
+	return record, true
+}
+
+// start reads header and builds column to field mapping
+func (c *csvSource) start() bool {
+	c.started = true
+	var header []string
+	if c.opts.Header {
+		record, ok := c.read()
+		if !ok {
+			return false
+		}
+		header = record
+	}
+	if c.opts.Prototype == nil {
+		return true
+	}
+	typ, ok := structType(c.opts.Prototype)
+	if !ok {
+		c.readErr = fmt.Errorf("csv prototype %T is not a struct", c.opts.Prototype)
+		return false
+	}
+	c.typ = typ
+	fields := structFields(typ, csvTag)
+	if header == nil {
+		for idx := range fields {
+			c.fields = append(c.fields, fields[idx].index)
+		}
+		return true
+	}
+	c.fields = make([][]int, len(header))
+	for col, name := range header {
+		for idx := range fields {
+			if strings.EqualFold(strings.TrimSpace(name), fields[idx].name) {
+				c.fields[col] = fields[idx].index
+				break
+			}
+		}
+	}
+	return true
+}
+
+func (c *csvSource) next() (interface{}, bool) {
+	if c.finished || (!c.started && !c.start()) {
+		c.finished = true
+		return nil, false
+	}
+	record, ok := c.read()
+	if !ok {
+		c.finished = true
+		return nil, false
+	}
+	c.index++
+	if c.typ == nil {
+		return record, true
+	}
+	ptr := reflect.New(c.typ)
+	for col := range record {
+		if col >= len(c.fields) || c.fields[col] == nil {
+			continue
+		}
+		if err := setString(record[col], ptr.Elem().FieldByIndex(c.fields[col])); err != nil {
+			// quoted fields may span lines, so the line is taken from reader rather than counted
+			line, _ := c.reader.FieldPos(col)
+			err = fmt.Errorf("csv line %d column %d: %v", line, col+1, err)
+			return badElement{&ElementError{Index: c.index - 1, Value: record, Err: err}}, true
+		}
+	}
+	if reflect.TypeOf(c.opts.Prototype).Kind() == reflect.Ptr {
+		return ptr.Interface(), true
+	}
+	return ptr.Elem().Interface(), true
+}
+
+func (c *csvSource) err() error {
+	return c.readErr
+}
+
+func (c *csvSource) close() {}
+
+// FromCSV creates a Stream of records read lazily from r. Each record is emitted as
+// []string, or as a value of the Prototype type if it is set in opts.
+// Errors occurred while reading are reported by Stream.Err, a record could not be parsed
+// is handled by the ErrorStrategy of stream
+func FromCSV(r io.Reader, opts CSVOptions) Stream {
+	reader := csv.NewReader(r)
+	reader.Comma = opts.comma()
+	return newStream(&csvSource{reader: reader, opts: opts})
+}
+
+type csvWriterOp struct {
+	terminalOp
+	l       sync.Mutex
+	writer  *csv.Writer
+	opts    CSVOptions
+	columns []string
+	typ     reflect.Type     // struct type of the first element
+	fields  map[string][]int // struct field index of columns
+	started bool
+	err     error
+}
+
+func (c *csvWriterOp) begin(_ int) {
+	c.writer.Comma = c.opts.comma()
+}
+
+// start decides columns from the first element and writes header
+func (c *csvWriterOp) start(t interface{}) error {
+	c.started = true
+	c.columns = c.opts.Columns
+	if typ, ok := structType(t); ok {
+		c.typ = typ
+		c.fields = make(map[string][]int)
+		for _, f := range structFields(typ, csvTag) {
+			c.fields[f.name] = f.index
+			if c.opts.Columns == nil {
+				c.columns = append(c.columns, f.name)
+			}
+		}
+	} else if val := reflect.ValueOf(t); val.Kind() == reflect.Map && c.columns == nil {
+		for _, key := range val.MapKeys() {
+			c.columns = append(c.columns, fmt.Sprint(key.Interface()))
+		}
+		sort.Strings(c.columns)
+	}
+	if c.opts.Header && c.columns != nil {
+		return c.writer.Write(c.columns)
+	}
+	return nil
+}
+
+func (c *csvWriterOp) record(t interface{}) ([]string, error) {
+	if record, ok := t.([]string); ok {
+		return record, nil
+	}
+	val := reflect.ValueOf(t)
+	if val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	record := make([]string, len(c.columns))
+	switch val.Kind() {
+	case reflect.Struct:
+		if c.fields == nil || val.Type() != c.typ {
+			return nil, fmt.Errorf("csv element %T does not match the first element", t)
+		}
+		for idx, column := range c.columns {
+			if index, ok := c.fields[column]; ok {
+				record[idx] = formatValue(val.FieldByIndex(index))
+			}
+		}
+	case reflect.Map:
+		if val.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("csv element %T should have string keys", t)
+		}
+		for idx, column := range c.columns {
+			record[idx] = formatValue(val.MapIndex(reflect.ValueOf(column).Convert(val.Type().Key())))
+		}
+	default:
+		return nil, fmt.Errorf("csv element %T should be struct, map or []string", t)
+	}
+	return record, nil
+}
+
+func (c *csvWriterOp) accept(t interface{}) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if c.err != nil {
+		return
+	}
+	if !c.started {
+		if c.err = c.start(t); c.err != nil {
+			return
+		}
+	}
+	record, err := c.record(t)
+	if err == nil {
+		err = c.writer.Write(record)
+	}
+	c.err = err
+}
+
+func (c *csvWriterOp) cancellationRequested() bool {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.err != nil
+}
+
+func (c *csvWriterOp) end() {
+	c.terminalOp.end()
+	c.writer.Flush()
+	if c.err == nil {
+		c.err = c.writer.Error()
+	}
+}
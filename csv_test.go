@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type person struct {
+	Name  string `csv:"name"`
+	Age   int    `csv:"age"`
+	Email string `csv:"-"`
+}
+
+func TestFromCSV(t *testing.T) {
+	input := "age,name,extra\n30,alice,x\n25,bob,y\n"
+	got := FromCSV(strings.NewReader(input), CSVOptions{Header: true, Prototype: person{}}).Collect()
+	if len(got) != 2 || got[0].(person) != (person{Name: "alice", Age: 30}) {
+		t.Fatalf("unexpected records %v", got)
+	}
+
+	rows := FromCSV(strings.NewReader("a;b\nc;d\n"), CSVOptions{Comma: ';'}).Collect()
+	if len(rows) != 2 || rows[1].([]string)[1] != "d" {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+
+	s := FromCSV(strings.NewReader("name,age\nalice,old\n"), CSVOptions{Header: true, Prototype: &person{}})
+	s.Collect()
+	if s.Err() == nil || !strings.Contains(s.Err().Error(), "line 2") {
+		t.Fatalf("expect parse error with line number, got %v", s.Err())
+	}
+
+	// the quoted name spans lines 2 to 4, the bad age of the next record is on line 5
+	s = FromCSV(strings.NewReader("name,age\n\"alice\nof\nwonderland\",30\nbob,old\n"), CSVOptions{Header: true, Prototype: person{}})
+	if got := s.Collect(); len(got) != 1 || got[0].(person).Name != "alice\nof\nwonderland" {
+		t.Fatalf("unexpected records %v", got)
+	}
+	if s.Err() == nil || !strings.Contains(s.Err().Error(), "line 5 column 2") {
+		t.Fatalf("expect parse error on line 5, got %v", s.Err())
+	}
+}
+
+func TestToCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := Of(person{"alice", 30, "a@b"}, &person{"bob", 25, ""}).ToCSV(&buf, CSVOptions{Header: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "name,age\nalice,30\nbob,25\n" {
+		t.Fatalf("unexpected csv %q", buf.String())
+	}
+
+	buf.Reset()
+	err = Of(map[string]int{"b": 2, "a": 1}).ToCSV(&buf, CSVOptions{Header: true})
+	if err != nil || buf.String() != "a,b\n1,2\n" {
+		t.Fatalf("unexpected csv %q, err %v", buf.String(), err)
+	}
+
+	if err = Of(1).ToCSV(&buf, CSVOptions{}); err == nil {
+		t.Fatal("expect error for unsupported element")
+	}
+
+	type pet struct {
+		Name string `csv:"name"`
+	}
+	if err = Of(person{"alice", 30, "a@b"}, pet{"tom"}).ToCSV(&buf, CSVOptions{}); err == nil {
+		t.Fatal("expect error for element of another struct type")
+	}
+}
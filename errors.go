@@ -0,0 +1,180 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ElementError describes an error occurred while processing an element,
+// Index is the position of the element among all elements the failing stage received
+type ElementError struct {
+	Index int
+	Value interface{}
+	Err   error
+}
+
+func (e *ElementError) Error() string {
+	return fmt.Sprintf("element %d (%v): %v", e.Index, e.Value, e.Err)
+}
+
+func (e *ElementError) Unwrap() error {
+	return e.Err
+}
+
+// ErrCancelled is reported by a stream cancelled through Future.Cancel
+var ErrCancelled = errors.New("stream cancelled")
+
+// badElement is returned by a source in place of an element it failed to produce,
+// so that the error is handled by the ErrorStrategy of stream
+type badElement struct {
+	err *ElementError
+}
+
+// ErrorStrategy decides what an error aware stage does with an element it failed to process.
+// Error aware stages are MapAsync, MapAsyncOrdered, MapWithRetry, ToJSONLines, and the decoding
+// or scanning of FromCSV, FromJSONLines and FromRows. A strategy should be used by one stream.
+// ErrorStrategy can not be implemented outside this package, use FailFast, SkipAndCount,
+// CollectErrors or DeadLetter, the last one passes failed elements to any Sink
+type ErrorStrategy interface {
+	// handle is called with every element error, a non-nil result fails the stream
+	handle(err *ElementError) error
+	// done is called once the stream is done, a non-nil result becomes the error of stream
+	done() error
+}
+
+type failFast struct{}
+
+func (failFast) handle(err *ElementError) error {
+	return err
+}
+
+func (failFast) done() error {
+	return nil
+}
+
+// FailFast fails the stream with the first element error, it is the default strategy
+var FailFast ErrorStrategy = failFast{}
+
+// ErrorCounter is an ErrorStrategy which drops failed elements and counts them
+type ErrorCounter struct {
+	count int64
+}
+
+// SkipAndCount creates an ErrorCounter
+func SkipAndCount() *ErrorCounter {
+	return &ErrorCounter{}
+}
+
+func (e *ErrorCounter) handle(_ *ElementError) error {
+	atomic.AddInt64(&e.count, 1)
+	return nil
+}
+
+func (e *ErrorCounter) done() error {
+	return nil
+}
+
+// Count returns the count of failed elements
+func (e *ErrorCounter) Count() int {
+	return int(atomic.LoadInt64(&e.count))
+}
+
+// MultiError holds all the element errors of a stream uses CollectErrors
+type MultiError struct {
+	Errors []*ElementError
+}
+
+func (m *MultiError) Error() string {
+	if len(m.Errors) == 1 {
+		return m.Errors[0].Error()
+	}
+	return fmt.Sprintf("%d elements failed, first: %v", len(m.Errors), m.Errors[0])
+}
+
+// Is reports whether any of the element errors matches target, so that errors.Is checks each of them
+func (m *MultiError) Is(target error) bool {
+	for _, err := range m.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first element error which matches target, so that errors.As checks each of them
+func (m *MultiError) As(target interface{}) bool {
+	for _, err := range m.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+type errorCollector struct {
+	l    sync.Mutex
+	errs []*ElementError
+}
+
+// CollectErrors drops failed elements, and fails the stream with a MultiError
+// holding all the element errors once the stream is done
+func CollectErrors() ErrorStrategy {
+	return &errorCollector{}
+}
+
+func (e *errorCollector) handle(err *ElementError) error {
+	e.l.Lock()
+	e.errs = append(e.errs, err)
+	e.l.Unlock()
+	return nil
+}
+
+func (e *errorCollector) done() error {
+	e.l.Lock()
+	defer e.l.Unlock()
+	if len(e.errs) == 0 {
+		return nil
+	}
+	return &MultiError{Errors: e.errs}
+}
+
+type deadLetter struct {
+	l       sync.Mutex
+	sink    Sink
+	started bool
+}
+
+// DeadLetter drops failed elements from the stream, and sends their *ElementError, which
+// holds the element and its error, to sink. Calls to sink are serialized, sink begins
+// before the first error and ends once the stream is done, the error of sink fails the
+// stream if it is an ErrorSink
+func DeadLetter(sink Sink) ErrorStrategy {
+	return &deadLetter{sink: sink}
+}
+
+func (d *deadLetter) start() {
+	if !d.started {
+		d.started = true
+		d.sink.Begin(0)
+	}
+}
+
+func (d *deadLetter) handle(err *ElementError) error {
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.start()
+	if !d.sink.CancellationRequested() {
+		d.sink.Accept(err)
+	}
+	return nil
+}
+
+func (d *deadLetter) done() error {
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.start()
+	d.sink.End()
+	return sinkErr(d.sink)
+}
@@ -0,0 +1,144 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSkipAndCount(t *testing.T) {
+	counter := SkipAndCount()
+	s := FromJSONLines(strings.NewReader("1\nbad\n2\n{\n3\n"), 0).WithErrorStrategy(counter)
+	got := s.Collect()
+	if !reflect.DeepEqual(got, []interface{}{1, 2, 3}) || s.Err() != nil {
+		t.Fatalf("unexpected result %v, error %v", got, s.Err())
+	}
+	if counter.Count() != 2 {
+		t.Fatalf("expect 2 errors counted, got %d", counter.Count())
+	}
+
+	var buf bytes.Buffer
+	err := Of(1, func() {}, 3).WithErrorStrategy(SkipAndCount()).ToJSONLines(&buf)
+	if err != nil || buf.String() != "1\n3\n" {
+		t.Fatalf("unexpected output %q, error %v", buf.String(), err)
+	}
+}
+
+func TestCollectErrors(t *testing.T) {
+	s := Of(1, 2, 3, 4, 5).WithErrorStrategy(CollectErrors()).MapAsyncOrdered(2, func(v interface{}) (interface{}, error) {
+		if v.(int)%2 == 0 {
+			return nil, errFlaky
+		}
+		return v, nil
+	})
+	got := s.Collect()
+	if !reflect.DeepEqual(got, []interface{}{1, 3, 5}) {
+		t.Fatalf("unexpected result %v", got)
+	}
+	var multi *MultiError
+	if !errors.As(s.Err(), &multi) || len(multi.Errors) != 2 || !errors.Is(s.Err(), errFlaky) {
+		t.Fatalf("unexpected error %v", s.Err())
+	}
+	if multi.Errors[0].Index != 1 || multi.Errors[1].Index != 3 {
+		t.Fatalf("unexpected indexes of errors %v", multi.Errors)
+	}
+	var elementErr *ElementError
+	if !errors.As(s.Err(), &elementErr) || elementErr.Index != 1 || errors.Is(s.Err(), ErrCancelled) {
+		t.Fatalf("unexpected element errors of %v", s.Err())
+	}
+
+	s = Of(1, 3).WithErrorStrategy(CollectErrors()).MapWithRetry(func(v interface{}) (interface{}, error) {
+		return v, nil
+	}, RetryPolicy{})
+	if s.Count(); s.Err() != nil {
+		t.Fatalf("expect no error, got %v", s.Err())
+	}
+}
+
+// letters records the elements and calls of a dead letter sink
+type letters struct {
+	began, ended bool
+	errs         []*ElementError
+}
+
+func (l *letters) Begin(_ int) {
+	l.began = true
+}
+
+func (l *letters) Accept(v interface{}) {
+	l.errs = append(l.errs, v.(*ElementError))
+}
+
+func (l *letters) End() {
+	l.ended = true
+}
+
+func (l *letters) CancellationRequested() bool {
+	return false
+}
+
+func TestDeadLetter(t *testing.T) {
+	type row struct {
+		Name string `csv:"name"`
+		Age  int    `csv:"age"`
+	}
+	dead := &letters{}
+	s := FromCSV(strings.NewReader("name,age\nann,3\nbob,x\ncat,5\n"), CSVOptions{Header: true, Prototype: row{}}).
+		WithErrorStrategy(DeadLetter(dead))
+	got := s.Collect()
+	if len(got) != 2 || got[1].(row).Name != "cat" || s.Err() != nil {
+		t.Fatalf("unexpected result %v, error %v", got, s.Err())
+	}
+	if !dead.began || !dead.ended || len(dead.errs) != 1 {
+		t.Fatalf("unexpected dead letters %+v", dead)
+	}
+	if e := dead.errs[0]; e.Index != 1 || !reflect.DeepEqual(e.Value, []string{"bob", "x"}) ||
+		!strings.Contains(e.Error(), "line 3") {
+		t.Fatalf("unexpected dead letter %v", e)
+	}
+}
+
+// brokenLetters is a dead letter sink which fails to store letters
+type brokenLetters struct {
+	letters
+}
+
+func (b *brokenLetters) Err() error {
+	if len(b.errs) > 0 {
+		return errors.New("letters lost")
+	}
+	return nil
+}
+
+func TestDeadLetterSinkError(t *testing.T) {
+	type row struct {
+		Name string `csv:"name"`
+		Age  int    `csv:"age"`
+	}
+	dead := &brokenLetters{}
+	s := FromCSV(strings.NewReader("name,age\nann,x\n"), CSVOptions{Header: true, Prototype: row{}}).
+		WithErrorStrategy(DeadLetter(dead))
+	s.Collect()
+	if s.Err() == nil || s.Err().Error() != "letters lost" {
+		t.Fatalf("expect error of dead letter sink, got %v", s.Err())
+	}
+}
+
+func TestWithErrorStrategyReturnsStage(t *testing.T) {
+	s := Of(1, 2, 3).MapWithRetry(func(v interface{}) (interface{}, error) {
+		if v.(int) == 2 {
+			return nil, errFlaky
+		}
+		return v, nil
+	}, RetryPolicy{})
+	counter := SkipAndCount()
+	handled := s.WithErrorStrategy(counter)
+	if handled != s {
+		t.Fatalf("expect the MapWithRetry stage returned, got %T", handled)
+	}
+	if got := handled.Collect(); len(got) != 2 || counter.Count() != 1 || handled.Err() != nil {
+		t.Fatalf("unexpected result %v, %d skipped, error %v", got, counter.Count(), handled.Err())
+	}
+}
@@ -0,0 +1,192 @@
+package stream
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Sink is the protocol stages use to pass data to each other, it is the exported
+// form of the protocol built in stages follow. Begin is called before any data with a
+// size hint, non-positive size means unknown. Accept is called for every element, and End
+// is called once data sending is done. CancellationRequested reports whether the sink
+// wants no more data, upstream checks it before sending each element
+type Sink interface {
+	Begin(size int)
+	Accept(v interface{})
+	End()
+	CancellationRequested() bool
+}
+
+// StageFlags declares the behaviors of a user defined stage, an Operator or a terminal Sink
+type StageFlags struct {
+	// ParallelSafe means the Sink may be called concurrently, otherwise calls to it
+	// are serialized when it runs after Parallel
+	ParallelSafe bool
+	// PreservesSize means the operator passes as many elements as it receives,
+	// it is not used by terminals
+	PreservesSize bool
+	// PreservesOrder means the operator passes elements in the order it receives them,
+	// it is not used by terminals
+	PreservesOrder bool
+}
+
+// FlaggedSink is a terminal Sink which declares its behaviors, a terminal Sink which
+// does not implement it is treated as not ParallelSafe
+type FlaggedSink interface {
+	Sink
+	Flags() StageFlags
+}
+
+// ErrorSink is a Sink which may fail, Into returns its error if the stream itself
+// succeeded, DeadLetter reports the error of its sink the same way
+type ErrorSink interface {
+	Sink
+	// Err returns the first error occurred in sink, it is called after End
+	Err() error
+}
+
+// sinkErr returns the error of sink if it is an ErrorSink
+func sinkErr(s Sink) error {
+	if e, ok := s.(ErrorSink); ok {
+		return e.Err()
+	}
+	return nil
+}
+
+// Operator is a user defined intermediate operation which could be added to a Stream by Via
+type Operator interface {
+	// Name is the name of operation shown by Explain and Observer
+	Name() string
+	// Flags declares the behaviors of operation
+	Flags() StageFlags
+	// Wrap creates the Sink which receives data of upstream and passes results to downstream,
+	// it is called once each time the stream runs
+	Wrap(downstream Sink) Sink
+}
+
+// exportedSink exposes a built in sink as Sink
+type exportedSink struct {
+	s sink
+}
+
+func (e exportedSink) Begin(size int) {
+	e.s.begin(size)
+}
+
+func (e exportedSink) Accept(v interface{}) {
+	e.s.accept(v)
+}
+
+func (e exportedSink) End() {
+	e.s.end()
+}
+
+func (e exportedSink) CancellationRequested() bool {
+	return e.s.cancellationRequested()
+}
+
+// guardedSink serializes calls to a Sink which is not parallel safe
+type guardedSink struct {
+	l sync.Mutex
+	s Sink
+}
+
+func (g *guardedSink) Begin(size int) {
+	g.l.Lock()
+	defer g.l.Unlock()
+	g.s.Begin(size)
+}
+
+func (g *guardedSink) Accept(v interface{}) {
+	g.l.Lock()
+	defer g.l.Unlock()
+	g.s.Accept(v)
+}
+
+func (g *guardedSink) End() {
+	g.l.Lock()
+	defer g.l.Unlock()
+	g.s.End()
+}
+
+func (g *guardedSink) CancellationRequested() bool {
+	g.l.Lock()
+	defer g.l.Unlock()
+	return g.s.CancellationRequested()
+}
+
+// operatorOp runs a user defined Operator
+type operatorOp struct {
+	baseStage
+	op   Operator
+	user Sink
+}
+
+func (o *operatorOp) describe(node *planNode) {
+	flags := o.op.Flags()
+	node.name, node.params = o.op.Name(), ""
+	// elements may be changed by operator, only what flags declare is kept
+	node.characteristics &^= Distinct | Sorted | NonNull
+	if !flags.PreservesSize {
+		node.characteristics &^= Sized
+	}
+	if !flags.PreservesOrder {
+		node.characteristics &^= Ordered
+	}
+}
+
+func (o *operatorOp) begin(size int) {
+	// wrap at begin, since downstream may be replaced before the stream runs
+	o.user = o.op.Wrap(exportedSink{o.downStream})
+	if o.node.concurrent && !o.op.Flags().ParallelSafe {
+		o.user = &guardedSink{s: o.user}
+	}
+	o.user.Begin(size)
+}
+
+func (o *operatorOp) accept(t interface{}) {
+	o.user.Accept(t)
+}
+
+func (o *operatorOp) end() {
+	o.user.End()
+}
+
+func (o *operatorOp) cancellationRequested() bool {
+	return o.user != nil && o.user.CancellationRequested()
+}
+
+// intoOp runs a user defined terminal Sink
+type intoOp struct {
+	terminalOp
+	user Sink
+}
+
+func (i *intoOp) describe(node *planNode) {
+	node.params = ""
+	if named, ok := i.user.(interface{ Name() string }); ok {
+		node.name = named.Name()
+	} else {
+		node.name = fmt.Sprintf("Into(%T)", i.user)
+	}
+}
+
+func (i *intoOp) begin(size int) {
+	if flagged, ok := i.user.(FlaggedSink); i.node.concurrent && !(ok && flagged.Flags().ParallelSafe) {
+		i.user = &guardedSink{s: i.user}
+	}
+	i.user.Begin(size)
+}
+
+func (i *intoOp) accept(t interface{}) {
+	i.user.Accept(t)
+}
+
+func (i *intoOp) end() {
+	i.terminalOp.end()
+	i.user.End()
+}
+
+func (i *intoOp) cancellationRequested() bool {
+	return i.user.CancellationRequested()
+}
@@ -0,0 +1,173 @@
+package stream
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dedupe drops elements equal to the previous one
+type dedupe struct{}
+
+func (dedupe) Name() string {
+	return "Dedupe"
+}
+
+func (dedupe) Flags() StageFlags {
+	return StageFlags{PreservesOrder: true}
+}
+
+func (dedupe) Wrap(downstream Sink) Sink {
+	return &dedupeSink{downstream: downstream}
+}
+
+type dedupeSink struct {
+	downstream Sink
+	last       interface{}
+	seen       bool
+}
+
+func (d *dedupeSink) Begin(_ int) {
+	d.downstream.Begin(0)
+}
+
+func (d *dedupeSink) Accept(v interface{}) {
+	if d.seen && v == d.last {
+		return
+	}
+	d.seen, d.last = true, v
+	d.downstream.Accept(v)
+}
+
+func (d *dedupeSink) End() {
+	d.downstream.End()
+}
+
+func (d *dedupeSink) CancellationRequested() bool {
+	return d.downstream.CancellationRequested()
+}
+
+// sumSink is a terminal which is not parallel safe
+type sumSink struct {
+	sum   int
+	limit int
+}
+
+func (s *sumSink) Begin(_ int) {}
+
+func (s *sumSink) Accept(v interface{}) {
+	s.sum += v.(int)
+}
+
+func (s *sumSink) End() {}
+
+func (s *sumSink) CancellationRequested() bool {
+	return s.limit > 0 && s.sum >= s.limit
+}
+
+func TestVia(t *testing.T) {
+	s := Of(1, 1, 2, 2, 2, 3, 1).Via(dedupe{})
+	if !strings.Contains(s.Explain(), "1. Dedupe stateful [ordered]") {
+		t.Fatalf("unexpected plan:\n%s", s.Explain())
+	}
+	got := s.Collect()
+	if len(got) != 4 || got[3] != 1 {
+		t.Fatalf("unexpected result %v", got)
+	}
+}
+
+func TestInto(t *testing.T) {
+	sum := &sumSink{}
+	if err := New(dataGenerator()).Parallel().Into(sum); err != nil || sum.sum != 20100 {
+		t.Fatalf("expect 20100, got %d, err %v", sum.sum, err)
+	}
+	sum = &sumSink{limit: 10}
+	if err := New(dataGenerator()).Into(sum); err != nil || sum.sum != 10 {
+		t.Fatalf("expect 10, got %d, err %v", sum.sum, err)
+	}
+}
+
+// meetingSink declares ParallelSafe, its first Accept waits a while for the second one,
+// which can only arrive in time if calls are not serialized
+type meetingSink struct {
+	calls int32
+	met   chan struct{}
+	in    bool
+}
+
+func (m *meetingSink) Flags() StageFlags {
+	return StageFlags{ParallelSafe: true}
+}
+
+func (m *meetingSink) Begin(_ int) {}
+
+func (m *meetingSink) Accept(_ interface{}) {
+	switch atomic.AddInt32(&m.calls, 1) {
+	case 1:
+		select {
+		case <-m.met:
+			m.in = true
+		case <-time.After(time.Second):
+		}
+	case 2:
+		close(m.met)
+	}
+}
+
+func (m *meetingSink) End() {}
+
+func (m *meetingSink) CancellationRequested() bool {
+	return false
+}
+
+func TestIntoParallelSafeSink(t *testing.T) {
+	meeting := &meetingSink{met: make(chan struct{})}
+	if err := New(dataGenerator()).Parallel().Into(meeting); err != nil || meeting.calls != 200 {
+		t.Fatalf("expect 200 calls, got %d, err %v", meeting.calls, err)
+	}
+	if !meeting.in {
+		t.Fatal("calls to a parallel safe sink are serialized")
+	}
+}
+
+// failingSink fails once it receives a negative element
+type failingSink struct {
+	sumSink
+	err error
+}
+
+func (f *failingSink) Accept(v interface{}) {
+	if v.(int) < 0 && f.err == nil {
+		f.err = errors.New("negative element")
+	}
+	f.sumSink.Accept(v)
+}
+
+func (f *failingSink) Err() error {
+	return f.err
+}
+
+func TestIntoErrorSink(t *testing.T) {
+	sink := &failingSink{}
+	if err := Of(1, 2, 3).Into(sink); err != nil || sink.sum != 6 {
+		t.Fatalf("expect 6, got %d, err %v", sink.sum, err)
+	}
+	sink = &failingSink{}
+	if err := Of(1, -2, 3).Into(sink); err == nil || err.Error() != "negative element" {
+		t.Fatalf("expect error of sink, got %v", err)
+	}
+	// the error of stream comes first
+	errStream := errors.New("stream failed")
+	sink = &failingSink{}
+	err := Of(-1, 2).MapWithRetry(func(v interface{}) (interface{}, error) {
+		if v.(int) == 2 {
+			return nil, errStream
+		}
+		return v, nil
+	}, RetryPolicy{}).Into(sink)
+	if !errors.Is(err, errStream) || sink.err == nil {
+		t.Fatalf("expect error of stream, got %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package stream
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// Encoder writes elements of a spilled run
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder reads elements of a spilled run back, it should return io.EOF
+// when there is no more element
+type Decoder interface {
+	Decode() (interface{}, error)
+}
+
+// Codec creates Encoder and Decoder used by SortWith to spill data to disk
+type Codec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// SortOptions configures the external merge sort performed by SortWith
+type SortOptions struct {
+	// MaxInMemory is the maximum count of elements buffered in memory before
+	// they are sorted and spilled to disk, non-positive value means no limit
+	MaxInMemory int
+	// TempDir is the directory where spilled runs are written to,
+	// the default temporary directory is used if it is empty
+	TempDir string
+	// Codec serializes elements of spilled runs, GobCodec is used if it is nil
+	Codec Codec
+}
+
+// GobCodec is the default Codec of SortWith. Concrete types other than
+// the golang built in ones must be registered with gob.Register before use
+type GobCodec struct{}
+
+func (GobCodec) NewEncoder(w io.Writer) Encoder {
+	return gobEncoder{gob.NewEncoder(w)}
+}
+
+func (GobCodec) NewDecoder(r io.Reader) Decoder {
+	return gobDecoder{gob.NewDecoder(r)}
+}
+
+type gobEncoder struct {
+	enc *gob.Encoder
+}
+
+func (g gobEncoder) Encode(v interface{}) error {
+	return g.enc.Encode(&v)
+}
+
+type gobDecoder struct {
+	dec *gob.Decoder
+}
+
+func (g gobDecoder) Decode() (interface{}, error) {
+	var v interface{}
+	err := g.dec.Decode(&v)
+	return v, err
+}
+
+type externalSorterOp struct {
+	statefulOp
+	comparator ComparatorFunc
+	opts       SortOptions
+	data       []interface{}
+	runs       []string // file names of spilled runs
+	count      int
+	failed     bool
+}
+
+func (e *externalSorterOp) begin(size int) {
+	if e.node.skipped {
+		e.downStream.begin(size)
+		return
+	}
+	if e.opts.Codec == nil {
+		e.opts.Codec = GobCodec{}
+	}
+	if size > 0 && (e.opts.MaxInMemory <= 0 || size <= e.opts.MaxInMemory) {
+		e.data = make([]interface{}, 0, size)
+	} else {
+		e.data = make([]interface{}, 0)
+	}
+}
+
+func (e *externalSorterOp) accept(t interface{}) {
+	if e.node.skipped {
+		e.downStream.accept(t)
+		return
+	}
+	e.l.Lock()
+	defer e.l.Unlock()
+	if e.failed {
+		return
+	}
+	e.data = append(e.data, t)
+	e.count++
+	if e.opts.MaxInMemory > 0 && len(e.data) >= e.opts.MaxInMemory {
+		if err := e.spill(); err != nil {
+			e.failed = true
+			e.fail(err)
+		}
+	}
+}
+
+func (e *externalSorterOp) cancellationRequested() bool {
+	if e.node.skipped {
+		return e.stopRequested()
+	}
+	e.l.Lock()
+	defer e.l.Unlock()
+	return e.failed
+}
+
+// sortData sorts the buffered data stably, together with merging runs in the order
+// they were spilled the whole sort keeps the order of equal elements
+func (e *externalSorterOp) sortData() {
+	sort.SliceStable(e.data, func(i, j int) bool {
+		return e.comparator(e.data[i], e.data[j]) < 0
+	})
+}
+
+// spill sorts the buffered data and writes it to a new temp file
+func (e *externalSorterOp) spill() error {
+	e.sortData()
+	f, err := ioutil.TempFile(e.opts.TempDir, "go-stream-sort-")
+	if err != nil {
+		return err
+	}
+	e.runs = append(e.runs, f.Name())
+	w := bufio.NewWriter(f)
+	enc := e.opts.Codec.NewEncoder(w)
+	for idx := range e.data {
+		if err = enc.Encode(e.data[idx]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	e.data = e.data[:0]
+	return nil
+}
+
+func (e *externalSorterOp) end() {
+	if e.node.skipped {
+		e.downStream.end()
+		return
+	}
+	defer e.cleanup()
+	if e.failed {
+		e.downStream.begin(0)
+		e.downStream.end()
+		return
+	}
+	e.sortData()
+	if len(e.runs) == 0 {
+		e.downStream.begin(len(e.data))
+		for idx := range e.data {
+			if e.stopRequested() {
+				break
+			}
+			e.downStream.accept(e.data[idx])
+		}
+		e.downStream.end()
+		return
+	}
+	e.merge()
+}
+
+// merge performs a k-way merge of all the spilled runs and the in memory one
+func (e *externalSorterOp) merge() {
+	h := &runHeap{comparator: e.comparator}
+	for idx := range e.runs {
+		r, err := openFileRun(e.runs[idx], e.opts.Codec)
+		if err != nil {
+			e.fail(err)
+			break
+		}
+		h.runs = append(h.runs, r)
+	}
+	h.runs = append(h.runs, &sliceRun{data: e.data})
+	defer h.close()
+
+	if e.Err() != nil {
+		e.downStream.begin(0)
+		e.downStream.end()
+		return
+	}
+	e.downStream.begin(e.count)
+	h.init()
+	for h.Len() > 0 && !e.stopRequested() {
+		v, err := h.pop()
+		if err != nil {
+			e.fail(err)
+			break
+		}
+		e.downStream.accept(v)
+	}
+	if h.err != nil {
+		e.fail(h.err)
+	}
+	e.downStream.end()
+}
+
+func (e *externalSorterOp) cleanup() {
+	for idx := range e.runs {
+		os.Remove(e.runs[idx])
+	}
+	e.runs = nil
+	e.data = nil
+}
+
+// run is a sorted sequence of elements taking part in merge
+type run interface {
+	// next returns the next element, io.EOF is returned when run is exhausted
+	next() (interface{}, error)
+	close()
+}
+
+type sliceRun struct {
+	data []interface{}
+	pos  int
+}
+
+func (s *sliceRun) next() (interface{}, error) {
+	if s.pos >= len(s.data) {
+		return nil, io.EOF
+	}
+	s.pos++
+	return s.data[s.pos-1], nil
+}
+
+func (s *sliceRun) close() {}
+
+type fileRun struct {
+	f   *os.File
+	dec Decoder
+}
+
+func openFileRun(name string, codec Codec) (*fileRun, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fileRun{f: f, dec: codec.NewDecoder(bufio.NewReader(f))}, nil
+}
+
+func (f *fileRun) next() (interface{}, error) {
+	return f.dec.Decode()
+}
+
+func (f *fileRun) close() {
+	f.f.Close()
+}
+
+type runHead struct {
+	val interface{}
+	idx int // index of the run, keeps merge stable
+}
+
+// runHeap holds the head element of every unfinished run
+type runHeap struct {
+	comparator ComparatorFunc
+	runs       []run
+	heads      []runHead
+	err        error
+}
+
+func (h *runHeap) init() {
+	for idx := range h.runs {
+		h.advance(idx)
+	}
+	heap.Init(h)
+}
+
+// advance reads the next element of the idx-th run into heads
+func (h *runHeap) advance(idx int) {
+	v, err := h.runs[idx].next()
+	if err == io.EOF {
+		return
+	}
+	if err != nil {
+		if h.err == nil {
+			h.err = err
+		}
+		return
+	}
+	h.heads = append(h.heads, runHead{val: v, idx: idx})
+}
+
+func (h *runHeap) pop() (interface{}, error) {
+	head := heap.Pop(h).(runHead)
+	before := len(h.heads)
+	h.advance(head.idx)
+	if len(h.heads) > before {
+		heap.Fix(h, len(h.heads)-1)
+	}
+	return head.val, h.err
+}
+
+func (h *runHeap) close() {
+	for idx := range h.runs {
+		h.runs[idx].close()
+	}
+}
+
+func (h *runHeap) Len() int {
+	return len(h.heads)
+}
+
+func (h *runHeap) Less(i, j int) bool {
+	c := h.comparator(h.heads[i].val, h.heads[j].val)
+	if c == 0 {
+		return h.heads[i].idx < h.heads[j].idx
+	}
+	return c < 0
+}
+
+func (h *runHeap) Swap(i, j int) {
+	h.heads[i], h.heads[j] = h.heads[j], h.heads[i]
+}
+
+func (h *runHeap) Push(x interface{}) {
+	h.heads = append(h.heads, x.(runHead))
+}
+
+func (h *runHeap) Pop() interface{} {
+	last := h.heads[len(h.heads)-1]
+	h.heads = h.heads[:len(h.heads)-1]
+	return last
+}
@@ -0,0 +1,75 @@
+package stream
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestSortWithSpillsToDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	given := rand.New(rand.NewSource(1)).Perm(1000)
+	s := New(given).SortWith(func(a interface{}, b interface{}) int {
+		return a.(int) - b.(int)
+	}, SortOptions{MaxInMemory: 64, TempDir: dir})
+	got := s.Collect()
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(given) {
+		t.Fatalf("expect %d elements, got %d", len(given), len(got))
+	}
+	for idx := range got {
+		if got[idx].(int) != idx {
+			t.Fatalf("expect %d at %d, got %v", idx, idx, got[idx])
+		}
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Fatalf("expect temp files removed, %d left", len(files))
+	}
+}
+
+func TestSortWithCancellation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	got := New(rand.Perm(500)).SortWith(func(a interface{}, b interface{}) int {
+		return a.(int) - b.(int)
+	}, SortOptions{MaxInMemory: 50, TempDir: dir}).Limit(3).Collect()
+	if len(got) != 3 || got[0] != 0 || got[2] != 2 {
+		t.Fatalf("unexpected result %v", got)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Fatalf("expect temp files removed, %d left", len(files))
+	}
+}
+
+func TestSortWithIsStable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := New(dataGenerator()).SortWith(func(a interface{}, b interface{}) int {
+		return a.(int)%7 - b.(int)%7
+	}, SortOptions{MaxInMemory: 32, TempDir: dir})
+	got := s.Collect()
+	if len(got) != 200 || s.Err() != nil {
+		t.Fatalf("expect 200 elements, got %d, error %v", len(got), s.Err())
+	}
+	for idx := 1; idx < len(got); idx++ {
+		prev, cur := got[idx-1].(int), got[idx].(int)
+		if prev%7 > cur%7 || (prev%7 == cur%7 && prev > cur) {
+			t.Fatalf("equal elements reordered: %d before %d", prev, cur)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package stream
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// FileEntry is the element emitted by FromDir and FromFS
+type FileEntry struct {
+	// Path is the path of file, it is joined with the root passed to FromDir or FromFS
+	Path string
+	Info fs.FileInfo
+}
+
+// DirOptions configures FromDir and FromFS
+type DirOptions struct {
+	// Pattern filters entries by matching their base names use path.Match, empty means all
+	Pattern string
+	// MaxDepth limits how deep the walk goes, entries directly under root have depth 1,
+	// non-positive value means no limit
+	MaxDepth int
+	// IncludeDirs emits directories as well as files
+	IncludeDirs bool
+}
+
+// dirFrame is a directory being walked
+type dirFrame struct {
+	dir     string
+	entries []fs.DirEntry
+	pos     int
+	depth   int
+}
+
+// dirSource walks a file system in lexical order lazily, a directory is read only
+// when the walk reaches it
+type dirSource struct {
+	fsys    fs.FS
+	root    string
+	opts    DirOptions
+	pathOf  func(name string) string // turns a path of fsys into the emitted path
+	stack   []*dirFrame
+	started bool
+	walkErr error
+}
+
+func (d *dirSource) size() int {
+	return 0
+}
+
+// characteristics of dirSource, every path is visited once in lexical order of each directory
+func (d *dirSource) characteristics() Characteristics {
+	return Ordered | Distinct | NonNull
+}
+
+func (d *dirSource) push(dir string, depth int) bool {
+	entries, err := fs.ReadDir(d.fsys, dir)
+	if err != nil {
+		d.walkErr = err
+		return false
+	}
+	d.stack = append(d.stack, &dirFrame{dir: dir, entries: entries, depth: depth})
+	return true
+}
+
+func (d *dirSource) match(name string) (bool, error) {
+	if d.opts.Pattern == "" {
+		return true, nil
+	}
+	return path.Match(d.opts.Pattern, name)
+}
+
+func (d *dirSource) next() (interface{}, bool) {
+	if !d.started {
+		d.started = true
+		if !d.push(d.root, 1) {
+			return nil, false
+		}
+	}
+	for len(d.stack) > 0 && d.walkErr == nil {
+		frame := d.stack[len(d.stack)-1]
+		if frame.pos >= len(frame.entries) {
+			d.stack = d.stack[:len(d.stack)-1]
+			continue
+		}
+		entry := frame.entries[frame.pos]
+		frame.pos++
+		name := path.Join(frame.dir, entry.Name())
+		if entry.IsDir() {
+			if d.opts.MaxDepth <= 0 || frame.depth < d.opts.MaxDepth {
+				if !d.push(name, frame.depth+1) {
+					return nil, false
+				}
+			}
+			if !d.opts.IncludeDirs {
+				continue
+			}
+		}
+		matched, err := d.match(entry.Name())
+		if err != nil {
+			d.walkErr = err
+			return nil, false
+		}
+		if !matched {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			d.walkErr = err
+			return nil, false
+		}
+		return FileEntry{Path: d.pathOf(name), Info: info}, true
+	}
+	return nil, false
+}
+
+func (d *dirSource) err() error {
+	return d.walkErr
+}
+
+func (d *dirSource) close() {
+	d.stack = nil
+}
+
+// FromFS creates a Stream of FileEntry under root of fsys, root itself is not emitted.
+// Directories are read lazily in lexical order, and the walk stops as soon as downstream
+// requests cancellation. Errors occurred while walking are reported by Stream.Err
+func FromFS(fsys fs.FS, root string, opts DirOptions) Stream {
+	return newStream(&dirSource{fsys: fsys, root: root, opts: opts, pathOf: func(name string) string {
+		return name
+	}})
+}
+
+// FromDir creates a Stream of FileEntry under the directory root like FromFS,
+// the Path of entries is an operating system path starts with root
+func FromDir(root string, opts DirOptions) Stream {
+	return newStream(&dirSource{fsys: os.DirFS(root), root: ".", opts: opts, pathOf: func(name string) string {
+		return filepath.Join(root, filepath.FromSlash(name))
+	}})
+}
@@ -0,0 +1,67 @@
+package stream
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"a.txt":       {Data: []byte("a")},
+		"b.log":       {Data: []byte("b")},
+		"sub/c.txt":   {Data: []byte("c")},
+		"sub/x/d.txt": {Data: []byte("d")},
+	}
+}
+
+func entryPaths(s Stream) []string {
+	paths := make([]string, 0)
+	s.ForEach(func(v interface{}) {
+		paths = append(paths, v.(FileEntry).Path)
+	})
+	return paths
+}
+
+func TestFromFS(t *testing.T) {
+	cases := []struct {
+		opts   DirOptions
+		expect []string
+	}{
+		{DirOptions{}, []string{"a.txt", "b.log", "sub/c.txt", "sub/x/d.txt"}},
+		{DirOptions{Pattern: "*.txt", MaxDepth: 2}, []string{"a.txt", "sub/c.txt"}},
+		{DirOptions{MaxDepth: 1, IncludeDirs: true}, []string{"a.txt", "b.log", "sub"}},
+	}
+	for _, c := range cases {
+		got := entryPaths(FromFS(testFS(), ".", c.opts))
+		if len(got) != len(c.expect) {
+			t.Fatalf("expect %v, got %v", c.expect, got)
+		}
+		for idx := range got {
+			if got[idx] != c.expect[idx] {
+				t.Fatalf("expect %v, got %v", c.expect, got)
+			}
+		}
+	}
+
+	s := FromFS(testFS(), "missing", DirOptions{})
+	if s.Count(); s.Err() == nil {
+		t.Fatal("expect error for missing root")
+	}
+}
+
+func TestFromDir(t *testing.T) {
+	dir, err := os.MkdirTemp("", "dir-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.WriteFile(filepath.Join(dir, "f.txt"), []byte("f"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got := FromDir(dir, DirOptions{}).First().(FileEntry)
+	if got.Path != filepath.Join(dir, "f.txt") || got.Info.Size() != 1 {
+		t.Fatalf("unexpected entry %+v", got)
+	}
+}
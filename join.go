@@ -0,0 +1,247 @@
+package stream
+
+type joinKind int
+
+const (
+	innerJoin joinKind = iota
+	leftJoin
+	rightJoin
+	fullOuterJoin
+)
+
+func (j joinKind) String() string {
+	switch j {
+	case innerJoin:
+		return "inner"
+	case leftJoin:
+		return "left"
+	case rightJoin:
+		return "right"
+	default:
+		return "full outer"
+	}
+}
+
+// CoGroupResult is the element emitted by CoGroup, it holds all the values of
+// both streams which share the same key
+type CoGroupResult struct {
+	Key   interface{}
+	Left  []interface{}
+	Right []interface{}
+}
+
+// keyIndex maps key to the indexes of elements which have that key,
+// keys keeps the order of key occurrence
+type keyIndex struct {
+	index map[interface{}][]int
+	keys  []interface{}
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{index: make(map[interface{}][]int)}
+}
+
+func (k *keyIndex) add(key interface{}, idx int) {
+	if _, ok := k.index[key]; !ok {
+		k.keys = append(k.keys, key)
+	}
+	k.index[key] = append(k.index[key], idx)
+}
+
+// joinOp performs a hash join between the upstream data (left side) and another
+// Stream (right side). The side with smaller size hint is used to build the hash table
+// and the other side is probed while it streams through: upstream data is probed in
+// accept, the right side is probed in end by running it into a sink. The right side is
+// hashed if the size of upstream is unknown
+type joinOp struct {
+	statefulOp
+	kind     joinKind
+	other    Stream
+	leftKey  KeyFunc
+	rightKey KeyFunc
+	combine  JoinFunc
+
+	right        []interface{}
+	rightIndex   *keyIndex
+	rightMatched []bool
+	buildLeft    bool
+	left         []interface{}
+	leftIndex    *keyIndex
+	leftMatched  []bool
+}
+
+// sizeHint returns the exact size of a Stream if it is known without running it, otherwise 0
+func sizeHint(s Stream) int {
+	st, ok := s.(stage)
+	if !ok || st.Characteristics()&Sized == 0 {
+		return 0
+	}
+	return st.getStartStage().src.size()
+}
+
+func (j *joinOp) keepLeft() bool {
+	return j.kind == leftJoin || j.kind == fullOuterJoin
+}
+
+func (j *joinOp) keepRight() bool {
+	return j.kind == rightJoin || j.kind == fullOuterJoin
+}
+
+func (j *joinOp) begin(size int) {
+	rightSize := sizeHint(j.other)
+	j.buildLeft = size > 0 && (rightSize <= 0 || size < rightSize)
+	if j.buildLeft {
+		j.left = make([]interface{}, 0, size)
+	} else {
+		j.right = j.other.Collect()
+		if err := j.other.Err(); err != nil {
+			j.fail(err)
+		}
+		j.rightIndex = newKeyIndex()
+		for idx := range j.right {
+			j.rightIndex.add(j.rightKey(j.right[idx]), idx)
+		}
+		j.rightMatched = make([]bool, len(j.right))
+	}
+	j.downStream.begin(0)
+}
+
+func (j *joinOp) accept(t interface{}) {
+	if j.buildLeft {
+		j.l.Lock()
+		j.left = append(j.left, t)
+		j.l.Unlock()
+		return
+	}
+	matches := j.rightIndex.index[j.leftKey(t)]
+	if len(matches) == 0 && j.keepLeft() && !j.stopRequested() {
+		j.downStream.accept(j.combine(t, nil))
+	}
+	for _, idx := range matches {
+		if j.stopRequested() {
+			break
+		}
+		j.l.Lock()
+		j.rightMatched[idx] = true
+		j.l.Unlock()
+		j.downStream.accept(j.combine(t, j.right[idx]))
+	}
+}
+
+func (j *joinOp) end() {
+	if j.buildLeft {
+		j.probeRight()
+	} else if j.keepRight() {
+		for idx := range j.right {
+			if j.stopRequested() {
+				break
+			}
+			if !j.rightMatched[idx] {
+				j.downStream.accept(j.combine(nil, j.right[idx]))
+			}
+		}
+	}
+	j.downStream.end()
+}
+
+// probeRight streams the right side through the hash table built from left side
+func (j *joinOp) probeRight() {
+	j.leftIndex = newKeyIndex()
+	for idx := range j.left {
+		j.leftIndex.add(j.leftKey(j.left[idx]), idx)
+	}
+	j.leftMatched = make([]bool, len(j.left))
+	if err := j.other.Into(probeSink{j}); err != nil {
+		j.fail(err)
+		return
+	}
+	if !j.keepLeft() {
+		return
+	}
+	for idx := range j.left {
+		if j.stopRequested() {
+			return
+		}
+		if !j.leftMatched[idx] {
+			j.downStream.accept(j.combine(j.left[idx], nil))
+		}
+	}
+}
+
+// probeSink receives the right side of a join whose left side is hashed
+type probeSink struct {
+	j *joinOp
+}
+
+func (p probeSink) Begin(_ int) {}
+
+func (p probeSink) Accept(v interface{}) {
+	j := p.j
+	matches := j.leftIndex.index[j.rightKey(v)]
+	if len(matches) == 0 && j.keepRight() {
+		j.downStream.accept(j.combine(nil, v))
+	}
+	for _, l := range matches {
+		if j.stopRequested() {
+			return
+		}
+		j.leftMatched[l] = true
+		j.downStream.accept(j.combine(j.left[l], v))
+	}
+}
+
+func (p probeSink) End() {}
+
+func (p probeSink) CancellationRequested() bool {
+	return p.j.stopRequested()
+}
+
+type coGroupOp struct {
+	statefulOp
+	other    Stream
+	leftKey  KeyFunc
+	rightKey KeyFunc
+	keys     []interface{}
+	groups   map[interface{}]*CoGroupResult
+}
+
+func (c *coGroupOp) begin(_ int) {
+	c.groups = make(map[interface{}]*CoGroupResult)
+}
+
+func (c *coGroupOp) group(key interface{}) *CoGroupResult {
+	g, ok := c.groups[key]
+	if !ok {
+		g = &CoGroupResult{Key: key}
+		c.groups[key] = g
+		c.keys = append(c.keys, key)
+	}
+	return g
+}
+
+func (c *coGroupOp) accept(t interface{}) {
+	key := c.leftKey(t)
+	c.l.Lock()
+	g := c.group(key)
+	g.Left = append(g.Left, t)
+	c.l.Unlock()
+}
+
+func (c *coGroupOp) end() {
+	right := c.other.Collect()
+	if err := c.other.Err(); err != nil {
+		c.fail(err)
+	}
+	for idx := range right {
+		g := c.group(c.rightKey(right[idx]))
+		g.Right = append(g.Right, right[idx])
+	}
+	c.downStream.begin(len(c.keys))
+	for _, key := range c.keys {
+		if c.stopRequested() {
+			break
+		}
+		c.downStream.accept(*c.groups[key])
+	}
+	c.downStream.end()
+}
@@ -0,0 +1,115 @@
+package stream
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+type order struct {
+	ID       int
+	Customer int
+}
+
+type customer struct {
+	ID   int
+	Name string
+}
+
+func joinedIDs(data []interface{}) []int {
+	ids := make([]int, 0, len(data))
+	for _, v := range data {
+		pair := v.([2]interface{})
+		id := -1
+		if pair[0] != nil {
+			id = pair[0].(order).ID
+		}
+		if pair[1] != nil {
+			id = id*100 + pair[1].(customer).ID
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func TestJoin(t *testing.T) {
+	orders := []order{{1, 1}, {2, 2}, {3, 1}, {4, 9}}
+	customers := []customer{{1, "a"}, {2, "b"}, {3, "c"}, {5, "e"}, {6, "f"}}
+	orderKey := func(v interface{}) interface{} { return v.(order).Customer }
+	customerKey := func(v interface{}) interface{} { return v.(customer).ID }
+	pair := func(l interface{}, r interface{}) interface{} { return [2]interface{}{l, r} }
+
+	unsized := func(s Stream) Stream {
+		return s.FlatMap(func(v interface{}) []interface{} { return []interface{}{v} })
+	}
+
+	cases := []struct {
+		name   string
+		join   func(s Stream, other Stream) Stream
+		expect []int
+	}{
+		{"inner", func(s Stream, other Stream) Stream { return s.Join(other, orderKey, customerKey, pair) }, []int{101, 202, 301}},
+		{"left", func(s Stream, other Stream) Stream { return s.LeftJoin(other, orderKey, customerKey, pair) }, []int{4, 101, 202, 301}},
+		{"right", func(s Stream, other Stream) Stream { return s.RightJoin(other, orderKey, customerKey, pair) }, []int{-97, -95, -94, 101, 202, 301}},
+		{"full", func(s Stream, other Stream) Stream { return s.FullOuterJoin(other, orderKey, customerKey, pair) }, []int{-97, -95, -94, 4, 101, 202, 301}},
+	}
+	for _, c := range cases {
+		// sized upstream smaller than the other side, left side is hashed and right side streams through
+		got := joinedIDs(c.join(New(orders), New(customers)).Collect())
+		if !equalInts(got, c.expect) {
+			t.Errorf("%s join: expect %v, got %v", c.name, c.expect, got)
+		}
+		// size of the other side is unknown, left side is hashed
+		got = joinedIDs(c.join(New(orders), unsized(New(customers))).Collect())
+		if !equalInts(got, c.expect) {
+			t.Errorf("%s join with unsized right: expect %v, got %v", c.name, c.expect, got)
+		}
+		// size of upstream is unknown, right side is hashed and upstream is probed
+		got = joinedIDs(c.join(unsized(New(orders)), New(customers)).Collect())
+		if !equalInts(got, c.expect) {
+			t.Errorf("%s join with hashed right: expect %v, got %v", c.name, c.expect, got)
+		}
+	}
+}
+
+func TestJoinStreamsProbeSide(t *testing.T) {
+	// the larger right side is cancelled once downstream has enough elements
+	pulled := 0
+	right := FromLines(strings.NewReader(strings.Repeat("x\n", 100))).Map(func(v interface{}) interface{} {
+		pulled++
+		return v
+	})
+	got := Of("x", "y").Join(right, func(v interface{}) interface{} { return v }, func(v interface{}) interface{} { return v },
+		func(l interface{}, r interface{}) interface{} { return r }).Limit(3).Collect()
+	if len(got) != 3 || pulled != 3 {
+		t.Fatalf("expect 3 elements from 3 pulled, got %v from %d", got, pulled)
+	}
+}
+
+func TestCoGroup(t *testing.T) {
+	got := Of(1, 2, 3, 4).CoGroup(Of(10, 11, 30), func(v interface{}) interface{} {
+		return v.(int) % 2
+	}, func(v interface{}) interface{} {
+		return v.(int) % 2
+	}).Collect()
+	if len(got) != 2 {
+		t.Fatalf("expect 2 groups, got %v", got)
+	}
+	odd := got[0].(CoGroupResult)
+	if odd.Key != 1 || len(odd.Left) != 2 || len(odd.Right) != 1 {
+		t.Fatalf("unexpected group %v", odd)
+	}
+}
+
+func equalInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,184 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// newPrototype returns a pointer to a new zero value of the prototype type,
+// a map[string]interface{} is used if prototype is nil
+func newPrototype(prototype interface{}) reflect.Value {
+	if prototype == nil {
+		return reflect.New(reflect.TypeOf(map[string]interface{}{}))
+	}
+	typ := reflect.TypeOf(prototype)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return reflect.New(typ)
+}
+
+type jsonLinesSource struct {
+	reader    *bufio.Reader
+	prototype interface{}
+	line      int
+	index     int // count of values read
+	readErr   error
+	finished  bool
+}
+
+func (j *jsonLinesSource) size() int {
+	return 0
+}
+
+func (j *jsonLinesSource) next() (interface{}, bool) {
+	for !j.finished {
+		line, err := j.reader.ReadBytes('\n')
+		if err != nil {
+			j.finished = true
+			if err != io.EOF {
+				j.readErr = err
+				return nil, false
+			}
+		}
+		j.line++
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		ptr := newPrototype(j.prototype)
+		j.index++
+		if err = json.Unmarshal(line, ptr.Interface()); err != nil {
+			err = fmt.Errorf("json line %d: %v", j.line, err)
+			return badElement{&ElementError{Index: j.index - 1, Value: string(line), Err: err}}, true
+		}
+		if j.prototype != nil && reflect.TypeOf(j.prototype).Kind() == reflect.Ptr {
+			return ptr.Interface(), true
+		}
+		return ptr.Elem().Interface(), true
+	}
+	return nil, false
+}
+
+func (j *jsonLinesSource) err() error {
+	return j.readErr
+}
+
+func (j *jsonLinesSource) close() {}
+
+// FromJSONLines creates a Stream of values decoded lazily from newline delimited json.
+// Each line is decoded into a new value of the prototype type, a pointer is emitted if
+// prototype is a pointer, map[string]interface{} is emitted if prototype is nil.
+// Blank lines are skipped, errors occurred while reading are reported by Stream.Err,
+// a line could not be decoded is handled by the ErrorStrategy of stream
+func FromJSONLines(r io.Reader, prototype interface{}) Stream {
+	return newStream(&jsonLinesSource{reader: bufio.NewReader(r), prototype: prototype})
+}
+
+type jsonArraySource struct {
+	decoder  *json.Decoder
+	started  bool
+	readErr  error
+	finished bool
+}
+
+func (j *jsonArraySource) size() int {
+	return 0
+}
+
+func (j *jsonArraySource) fail(err error) (interface{}, bool) {
+	j.readErr = err
+	j.finished = true
+	return nil, false
+}
+
+func (j *jsonArraySource) next() (interface{}, bool) {
+	if j.finished {
+		return nil, false
+	}
+	if !j.started {
+		j.started = true
+		token, err := j.decoder.Token()
+		if err != nil {
+			return j.fail(err)
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return j.fail(fmt.Errorf("json: expect array, got %v", token))
+		}
+	}
+	if !j.decoder.More() {
+		j.finished = true
+		if _, err := j.decoder.Token(); err != nil { // consume ']'
+			j.readErr = err
+		}
+		return nil, false
+	}
+	var v interface{}
+	if err := j.decoder.Decode(&v); err != nil {
+		return j.fail(err)
+	}
+	return v, true
+}
+
+func (j *jsonArraySource) err() error {
+	return j.readErr
+}
+
+func (j *jsonArraySource) close() {}
+
+// FromJSONArray creates a Stream of elements of a top level json array read from r,
+// elements are decoded one by one so the whole array is never held in memory.
+// Errors occurred while reading or decoding are reported by Stream.Err
+func FromJSONArray(r io.Reader) Stream {
+	return newStream(&jsonArraySource{decoder: json.NewDecoder(r)})
+}
+
+type jsonLinesWriterOp struct {
+	terminalOp
+	l      sync.Mutex
+	writer *bufio.Writer
+	index  int
+	err    error
+}
+
+// accept reports an element which can not be marshaled as an ElementError, which the
+// ErrorStrategy may drop, while an error of writer fails the stream, since the output
+// would be truncated
+func (j *jsonLinesWriterOp) accept(t interface{}) {
+	j.l.Lock()
+	defer j.l.Unlock()
+	if j.err != nil {
+		return
+	}
+	index := j.index
+	j.index++
+	data, err := json.Marshal(t)
+	if err != nil {
+		if e := (&ElementError{Index: index, Value: t, Err: err}); j.elementFailed(e) {
+			j.err = e
+		}
+		return
+	}
+	if _, err = j.writer.Write(append(data, '\n')); err != nil {
+		j.err = err
+		j.fail(err)
+	}
+}
+
+func (j *jsonLinesWriterOp) cancellationRequested() bool {
+	j.l.Lock()
+	defer j.l.Unlock()
+	return j.err != nil
+}
+
+func (j *jsonLinesWriterOp) end() {
+	j.terminalOp.end()
+	if err := j.writer.Flush(); err != nil && j.err == nil {
+		j.err = err
+		j.fail(err)
+	}
+}
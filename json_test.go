@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type event struct {
+	ID   int    `json:"id"`
+	Kind string `json:"kind"`
+}
+
+func TestFromJSONLines(t *testing.T) {
+	input := `{"id":1,"kind":"a"}` + "\n\n" + `{"id":2,"kind":"b"}` + "\n"
+	got := FromJSONLines(strings.NewReader(input), &event{}).Collect()
+	if len(got) != 2 || *got[1].(*event) != (event{2, "b"}) {
+		t.Fatalf("unexpected events %v", got)
+	}
+
+	maps := FromJSONLines(strings.NewReader(input), nil).Collect()
+	if len(maps) != 2 || maps[0].(map[string]interface{})["kind"] != "a" {
+		t.Fatalf("unexpected maps %v", maps)
+	}
+
+	s := FromJSONLines(strings.NewReader(input+"{bad\n"), event{})
+	if s.Count(); s.Err() == nil || !strings.Contains(s.Err().Error(), "line 4") {
+		t.Fatalf("expect decode error with line number, got %v", s.Err())
+	}
+}
+
+func TestFromJSONArray(t *testing.T) {
+	s := FromJSONArray(strings.NewReader(`[1, "two", {"three": 3}]`))
+	if got := s.Collect(); len(got) != 3 || got[1] != "two" || s.Err() != nil {
+		t.Fatalf("unexpected elements %v, err %v", got, s.Err())
+	}
+	s = FromJSONArray(strings.NewReader(`{"a": 1}`))
+	if s.Count(); s.Err() == nil {
+		t.Fatal("expect error for non array input")
+	}
+}
+
+func TestToJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Of(event{1, "a"}, map[string]int{"x": 1}).ToJSONLines(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "{\"id\":1,\"kind\":\"a\"}\n{\"x\":1}\n" {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+
+	err := Of(1, make(chan int), 3).ToJSONLines(&buf)
+	var elemErr *ElementError
+	if !errors.As(err, &elemErr) || elemErr.Index != 1 {
+		t.Fatalf("expect element error at index 1, got %v", err)
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(_ []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestToJSONLinesWriteError(t *testing.T) {
+	counter := SkipAndCount()
+	s := Of(1, make(chan int), 3).WithErrorStrategy(counter)
+	err := s.ToJSONLines(failingWriter{})
+	var elemErr *ElementError
+	if err == nil || err.Error() != "disk full" || errors.As(err, &elemErr) || s.Err() == nil {
+		t.Fatalf("expect the stream failed by error of writer, got %v", err)
+	}
+	if counter.Count() != 1 {
+		t.Fatalf("expect only the element could not be encoded skipped, got %d", counter.Count())
+	}
+}
@@ -0,0 +1,116 @@
+package stream
+
+import "fmt"
+
+// asyncResult is the result of mapping the element at index
+type asyncResult struct {
+	index  int
+	value  interface{}
+	result interface{}
+	err    error
+}
+
+// mapAsyncOp runs the mapper on its own goroutines with at most concurrency calls in flight,
+// results are passed to next stage on the goroutine which calls accept and end, so the stages
+// after it stay sequential. Results are passed in the order of elements if ordered is set,
+// otherwise in the order they complete
+type mapAsyncOp struct {
+	statefulOp
+	concurrency int
+	fn          AsyncMapFunc
+	ordered     bool
+	results     chan asyncResult
+	inFlight    int
+	count       int                 // count of elements received
+	next        int                 // index of the next result to pass if ordered
+	pending     map[int]asyncResult // completed results waiting for the ones before them
+	failed      bool
+}
+
+func (m *mapAsyncOp) begin(size int) {
+	m.results = make(chan asyncResult, m.concurrency)
+	m.pending = make(map[int]asyncResult)
+	m.downStream.begin(size)
+}
+
+func (m *mapAsyncOp) accept(t interface{}) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if m.failed || m.stopRequested() {
+		return
+	}
+	for m.inFlight >= m.concurrency {
+		m.deliver(<-m.results)
+	}
+	m.inFlight++
+	go m.call(m.count, t)
+	m.count++
+	for {
+		select {
+		case r := <-m.results:
+			m.deliver(r)
+		default:
+			return
+		}
+	}
+}
+
+func (m *mapAsyncOp) call(index int, t interface{}) {
+	r := asyncResult{index: index, value: t}
+	defer func() {
+		if p := recover(); p != nil {
+			r.err = fmt.Errorf("mapper panicked: %v", p)
+		}
+		m.results <- r
+	}()
+	r.result, r.err = m.fn(t)
+}
+
+// deliver handles a completed result, it should be called with lock held
+func (m *mapAsyncOp) deliver(r asyncResult) {
+	m.inFlight--
+	if m.failed {
+		return
+	}
+	if !m.ordered {
+		m.pass(r)
+		return
+	}
+	m.pending[r.index] = r
+	for !m.failed {
+		next, ok := m.pending[m.next]
+		if !ok {
+			return
+		}
+		delete(m.pending, m.next)
+		m.next++
+		m.pass(next)
+	}
+}
+
+// pass sends the result to next stage, or handles its error
+func (m *mapAsyncOp) pass(r asyncResult) {
+	if r.err != nil {
+		m.failed = m.elementFailed(&ElementError{Index: r.index, Value: r.value, Err: r.err})
+		return
+	}
+	if !m.stopRequested() {
+		m.downStream.accept(r.result)
+	}
+}
+
+func (m *mapAsyncOp) cancellationRequested() bool {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return m.failed || m.stopRequested()
+}
+
+// end waits for the calls in flight, results of a cancelled or failed stream are dropped
+func (m *mapAsyncOp) end() {
+	m.l.Lock()
+	for m.inFlight > 0 {
+		m.deliver(<-m.results)
+	}
+	m.l.Unlock()
+	m.downStream.end()
+}
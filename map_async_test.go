@@ -0,0 +1,97 @@
+package stream
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMapAsyncBoundedConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	got := New(dataGenerator()).MapAsync(3, func(v interface{}) (interface{}, error) {
+		current := atomic.AddInt32(&inFlight, 1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+		time.Sleep(100 * time.Microsecond)
+		atomic.AddInt32(&inFlight, -1)
+		return v.(int) * 2, nil
+	}).Collect()
+	if maxInFlight > 3 {
+		t.Fatalf("expect at most 3 calls in flight, got %d", maxInFlight)
+	}
+	ints := make([]int, 0, len(got))
+	for _, v := range got {
+		ints = append(ints, v.(int))
+	}
+	sort.Ints(ints)
+	for idx := range ints {
+		if ints[idx] != (idx+1)*2 {
+			t.Fatalf("unexpected result %v", ints)
+		}
+	}
+}
+
+func TestMapAsyncOrdered(t *testing.T) {
+	// later elements complete first
+	got := Of(1, 2, 3, 4, 5, 6).MapAsyncOrdered(4, func(v interface{}) (interface{}, error) {
+		time.Sleep(time.Duration(7-v.(int)) * time.Millisecond)
+		return v.(int) * 10, nil
+	}).Collect()
+	if !reflect.DeepEqual(got, []interface{}{10, 20, 30, 40, 50, 60}) {
+		t.Fatalf("unexpected result %v", got)
+	}
+}
+
+func TestMapAsyncError(t *testing.T) {
+	broken := errors.New("broken")
+	s := Of(1, 2, 3, 4, 5, 6, 7, 8).MapAsyncOrdered(2, func(v interface{}) (interface{}, error) {
+		if v.(int) == 5 {
+			return nil, broken
+		}
+		return v, nil
+	})
+	got := s.Collect()
+	if !reflect.DeepEqual(got, []interface{}{1, 2, 3, 4}) {
+		t.Fatalf("expect elements before the error passed, got %v", got)
+	}
+	var elementErr *ElementError
+	if !errors.As(s.Err(), &elementErr) || elementErr.Index != 4 || !errors.Is(s.Err(), broken) {
+		t.Fatalf("unexpected error %v", s.Err())
+	}
+
+	s = Of(1, 2, 3).MapAsync(2, func(v interface{}) (interface{}, error) {
+		if v.(int) == 2 {
+			panic("boom")
+		}
+		return v, nil
+	})
+	s.Count()
+	if s.Err() == nil {
+		t.Fatal("expect panic of mapper reported as error")
+	}
+}
+
+func TestMapAsyncCancellation(t *testing.T) {
+	var calls int32
+	sum := 0
+	// stages after MapAsync are called sequentially, so sum needs no lock
+	New(dataGenerator()).MapAsync(4, func(v interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return v, nil
+	}).Limit(5).ForEach(func(v interface{}) {
+		sum += v.(int)
+	})
+	if calls > 20 {
+		t.Fatalf("expect mapping stopped after Limit, got %d calls", calls)
+	}
+	if sum == 0 {
+		t.Fatal("expect elements passed to ForEach")
+	}
+}
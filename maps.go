@@ -0,0 +1,174 @@
+package stream
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Entry is a key value pair of a map
+type Entry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// DuplicatePolicy decides what ToMap does when more than one entry of stream has the same key,
+// keys already in the map before the stream runs are overwritten
+type DuplicatePolicy int
+
+const (
+	// KeepLast overwrites the value of a key with the later entry
+	KeepLast DuplicatePolicy = iota
+	// KeepFirst keeps the value of the first entry of a key
+	KeepFirst
+	// FailOnDuplicate makes ToMap return an error on duplicate key
+	FailOnDuplicate
+)
+
+// mapValue returns the reflect value of map m, it panics if m is not a map
+func mapValue(m interface{}) reflect.Value {
+	val := reflect.ValueOf(m)
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Map {
+		panic(fmt.Sprintf("%T is not a map", m))
+	}
+	return val
+}
+
+// mapSource iterates a map lazily, project turns each key value pair into an element
+type mapSource struct {
+	m       reflect.Value
+	iter    *reflect.MapIter
+	project func(k, v reflect.Value) interface{}
+	extra   Characteristics // characteristics of projected elements
+}
+
+func (m *mapSource) size() int {
+	return m.m.Len()
+}
+
+func (m *mapSource) characteristics() Characteristics {
+	return Sized | m.extra
+}
+
+func (m *mapSource) next() (interface{}, bool) {
+	if m.iter == nil {
+		m.iter = m.m.MapRange()
+	}
+	if !m.iter.Next() {
+		return nil, false
+	}
+	return m.project(m.iter.Key(), m.iter.Value()), true
+}
+
+func (m *mapSource) err() error {
+	return nil
+}
+
+func (m *mapSource) close() {}
+
+func entryOf(k, v reflect.Value) interface{} {
+	return Entry{Key: k.Interface(), Value: v.Interface()}
+}
+
+// FromMap creates a Stream of Entry of map m, the order of entries is not guaranteed
+func FromMap(m interface{}) Stream {
+	return newStream(&mapSource{m: mapValue(m), project: entryOf, extra: Distinct | NonNull})
+}
+
+// FromSortedMap creates a Stream of Entry of map m, entries are ordered by
+// their keys use the given ComparatorFunc
+func FromSortedMap(m interface{}, comparator ComparatorFunc) Stream {
+	val := mapValue(m)
+	keys := val.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return comparator(keys[i].Interface(), keys[j].Interface()) < 0
+	})
+	data := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		data = append(data, entryOf(key, val.MapIndex(key)))
+	}
+	return newStream(&sliceSource{data: data, extra: Distinct})
+}
+
+// Keys creates a Stream of keys of map m, the order of keys is not guaranteed
+func Keys(m interface{}) Stream {
+	return newStream(&mapSource{m: mapValue(m), project: func(k, _ reflect.Value) interface{} {
+		return k.Interface()
+	}, extra: Distinct})
+}
+
+// Values creates a Stream of values of map m, the order of values is not guaranteed
+func Values(m interface{}) Stream {
+	return newStream(&mapSource{m: mapValue(m), project: func(_, v reflect.Value) interface{} {
+		return v.Interface()
+	}})
+}
+
+type toMapOp struct {
+	terminalOp
+	l      sync.Mutex
+	out    interface{}
+	policy DuplicatePolicy
+	m      reflect.Value
+	keys   map[interface{}]struct{} // keys put by this stream
+	err    error
+}
+
+func (t *toMapOp) begin(_ int) {
+	if t.out == nil || !isPtr(t.out) || settableValue(t.out).Kind() != reflect.Map {
+		t.err = fmt.Errorf("ToMap needs a pointer to map, got %T", t.out)
+		return
+	}
+	t.keys = make(map[interface{}]struct{})
+	t.m = settableValue(t.out)
+	if t.m.IsNil() {
+		t.m.Set(reflect.MakeMap(t.m.Type()))
+	}
+}
+
+func (t *toMapOp) put(v interface{}) error {
+	entry, ok := v.(Entry)
+	if !ok {
+		return fmt.Errorf("%T is not an Entry", v)
+	}
+	key, value := reflect.New(t.m.Type().Key()).Elem(), reflect.New(t.m.Type().Elem()).Elem()
+	if entry.Key != nil {
+		if err := setValue(reflect.ValueOf(entry.Key), key); err != nil {
+			return err
+		}
+	}
+	if entry.Value != nil {
+		if err := setValue(reflect.ValueOf(entry.Value), value); err != nil {
+			return err
+		}
+	}
+	if _, ok := t.keys[key.Interface()]; ok {
+		switch t.policy {
+		case KeepFirst:
+			return nil
+		case FailOnDuplicate:
+			return fmt.Errorf("duplicate key %v", entry.Key)
+		}
+	}
+	t.keys[key.Interface()] = struct{}{}
+	t.m.SetMapIndex(key, value)
+	return nil
+}
+
+func (t *toMapOp) accept(v interface{}) {
+	t.l.Lock()
+	defer t.l.Unlock()
+	if t.err == nil {
+		t.err = t.put(v)
+	}
+}
+
+func (t *toMapOp) cancellationRequested() bool {
+	t.l.Lock()
+	defer t.l.Unlock()
+	return t.err != nil
+}
@@ -0,0 +1,51 @@
+package stream
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFromMap(t *testing.T) {
+	m := map[string]int{"b": 2, "a": 1, "c": 3}
+	got := FromSortedMap(m, func(a interface{}, b interface{}) int {
+		return strings.Compare(a.(string), b.(string))
+	}).Collect()
+	if len(got) != 3 || got[0] != (Entry{"a", 1}) || got[2] != (Entry{"c", 3}) {
+		t.Fatalf("unexpected entries %v", got)
+	}
+	if count := New(m).Count(); count != 3 {
+		t.Fatalf("expect 3 entries, got %d", count)
+	}
+	sum := 0
+	Values(m).ForEach(func(v interface{}) {
+		sum += v.(int)
+	})
+	if sum != 6 || Keys(m).Count() != 3 {
+		t.Fatalf("unexpected values sum %d", sum)
+	}
+}
+
+func TestToMap(t *testing.T) {
+	var out map[string]int
+	err := Of(Entry{"a", 1}, Entry{"b", 2}, Entry{"a", 3}).ToMap(&out, KeepFirst)
+	if err != nil || len(out) != 2 || out["a"] != 1 {
+		t.Fatalf("unexpected map %v, err %v", out, err)
+	}
+	err = Of(Entry{"a", 1}, Entry{"a", 3}).ToMap(&out, KeepLast)
+	if err != nil || out["a"] != 3 {
+		t.Fatalf("unexpected map %v, err %v", out, err)
+	}
+	if err = Of(Entry{"a", 1}, Entry{"a", 3}).ToMap(&out, FailOnDuplicate); err == nil {
+		t.Fatal("expect duplicate key error")
+	}
+	if err = Of(Entry{1, 1}).ToMap(&out, KeepLast); err == nil {
+		t.Fatal("expect key type error")
+	}
+	out = map[string]int{"a": 0}
+	if err = Of(Entry{"a", 1}, Entry{"b", 2}).ToMap(&out, FailOnDuplicate); err != nil || out["a"] != 1 {
+		t.Fatalf("expect key of caller overwritten, got %v, err %v", out, err)
+	}
+	if err = Of(Entry{"a", 1}).ToMap(nil, KeepLast); err == nil || !strings.Contains(err.Error(), "pointer to map") {
+		t.Fatalf("expect error for nil out, got %v", err)
+	}
+}
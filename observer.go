@@ -0,0 +1,192 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType is the type of StageEvent
+type EventType int
+
+const (
+	// EventBegin is sent when a stage is about to receive data
+	EventBegin EventType = iota
+	// EventAccept is sent after a stage processed an element
+	EventAccept
+	// EventEnd is sent after a stage and all stages after it finished
+	EventEnd
+	// EventCancel is sent the first time a stage requests cancellation
+	EventCancel
+)
+
+func (e EventType) String() string {
+	switch e {
+	case EventBegin:
+		return "begin"
+	case EventAccept:
+		return "accept"
+	case EventEnd:
+		return "end"
+	default:
+		return "cancel"
+	}
+}
+
+// StageMetrics is the statistic of a stage. In is the count of elements the stage received,
+// Out is the count of elements it passed to next stage, and Elapsed is the cumulative time
+// spent in the stage itself, excluding the time spent in stages after it
+type StageMetrics struct {
+	Index     int
+	Stage     string
+	In        int64
+	Out       int64
+	Elapsed   time.Duration
+	Cancelled bool
+}
+
+// StageEvent is sent to Observer, Size is the size hint passed to the stage on EventBegin
+type StageEvent struct {
+	Type EventType
+	Size int
+	StageMetrics
+}
+
+// Observer receives events of stages, it must be safe for concurrent use
+// if it observes a parallel stream
+type Observer interface {
+	Observe(event StageEvent)
+}
+
+// stageMeter counts elements and time of a stage
+type stageMeter struct {
+	index     int
+	name      string
+	in        int64
+	elapsed   int64 // nanoseconds spent in the stage and stages after it
+	cancelled int32
+	next      *stageMeter
+}
+
+func (m *stageMeter) metrics() StageMetrics {
+	res := StageMetrics{
+		Index:     m.index,
+		Stage:     m.name,
+		In:        atomic.LoadInt64(&m.in),
+		Elapsed:   time.Duration(atomic.LoadInt64(&m.elapsed)),
+		Cancelled: atomic.LoadInt32(&m.cancelled) == 1,
+	}
+	if m.next != nil {
+		res.Out = atomic.LoadInt64(&m.next.in)
+		if res.Elapsed -= time.Duration(atomic.LoadInt64(&m.next.elapsed)); res.Elapsed < 0 {
+			// stages after a parallel stage run on other goroutines
+			res.Elapsed = 0
+		}
+	}
+	return res
+}
+
+// observedSink wraps a stage, reports its events to observers
+type observedSink struct {
+	inner     stage
+	meter     *stageMeter
+	observers []Observer
+}
+
+func (o *observedSink) notify(t EventType, size int, m StageMetrics) {
+	for _, observer := range o.observers {
+		observer.Observe(StageEvent{Type: t, Size: size, StageMetrics: m})
+	}
+}
+
+func (o *observedSink) begin(size int) {
+	o.notify(EventBegin, size, o.meter.metrics())
+	start := time.Now()
+	o.inner.begin(size)
+	atomic.AddInt64(&o.meter.elapsed, int64(time.Since(start)))
+}
+
+func (o *observedSink) accept(t interface{}) {
+	atomic.AddInt64(&o.meter.in, 1)
+	start := time.Now()
+	o.inner.accept(t)
+	atomic.AddInt64(&o.meter.elapsed, int64(time.Since(start)))
+	o.notify(EventAccept, 0, StageMetrics{Index: o.meter.index, Stage: o.meter.name, In: atomic.LoadInt64(&o.meter.in)})
+}
+
+func (o *observedSink) end() {
+	start := time.Now()
+	o.inner.end()
+	atomic.AddInt64(&o.meter.elapsed, int64(time.Since(start)))
+	o.notify(EventEnd, 0, o.meter.metrics())
+}
+
+func (o *observedSink) cancellationRequested() bool {
+	cancelled := o.inner.cancellationRequested()
+	if cancelled && atomic.CompareAndSwapInt32(&o.meter.cancelled, 0, 1) {
+		o.notify(EventCancel, 0, o.meter.metrics())
+	}
+	return cancelled
+}
+
+// observe wraps every stage after start with observedSink
+func observe(start *startOp) {
+	chain := chainOf(start)
+	var next *stageMeter
+	for idx := len(chain) - 1; idx > 0; idx-- {
+		meter := &stageMeter{index: idx, name: chain[idx].getNode().name, next: next}
+		chain[idx-1].setNextSink(&observedSink{inner: chain[idx], meter: meter, observers: start.observers})
+		next = meter
+	}
+}
+
+// MetricsCollector is an Observer which keeps the metrics of every stage
+// reported when the stage ends
+type MetricsCollector struct {
+	l       sync.Mutex
+	metrics map[int]StageMetrics
+}
+
+// NewMetricsCollector creates an empty MetricsCollector
+func NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{metrics: make(map[int]StageMetrics)}
+}
+
+func (m *MetricsCollector) Observe(event StageEvent) {
+	if event.Type != EventEnd {
+		return
+	}
+	m.l.Lock()
+	m.metrics[event.Index] = event.StageMetrics
+	m.l.Unlock()
+}
+
+// Report returns metrics of stages ordered by their position in stream,
+// it should be called after the terminal operation returns
+func (m *MetricsCollector) Report() []StageMetrics {
+	m.l.Lock()
+	defer m.l.Unlock()
+	report := make([]StageMetrics, 0, len(m.metrics))
+	for idx := 0; len(report) < len(m.metrics); idx++ {
+		if metrics, ok := m.metrics[idx]; ok {
+			report = append(report, metrics)
+		}
+	}
+	return report
+}
+
+// String formats the report as a table
+func (m *MetricsCollector) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-4s %-24s %10s %10s %14s\n", "#", "stage", "in", "out", "elapsed")
+	for _, metrics := range m.Report() {
+		name := metrics.Stage
+		if metrics.Cancelled {
+			name += " (cancelled)"
+		}
+		fmt.Fprintf(&b, "%-4d %-24s %10d %10d %14s\n", metrics.Index, name, metrics.In, metrics.Out, metrics.Elapsed)
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package stream
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+type eventRecorder struct {
+	l      sync.Mutex
+	counts map[EventType]int
+}
+
+func (e *eventRecorder) Observe(event StageEvent) {
+	e.l.Lock()
+	e.counts[event.Type]++
+	e.l.Unlock()
+}
+
+func TestObserver(t *testing.T) {
+	metrics := NewMetricsCollector()
+	recorder := &eventRecorder{counts: make(map[EventType]int)}
+	got := New(dataGenerator()).WithObserver(metrics).WithObserver(recorder).Filter(func(v interface{}) bool {
+		return v.(int)%2 == 0
+	}).Sort(func(a interface{}, b interface{}) int {
+		return b.(int) - a.(int)
+	}).Limit(5).Collect()
+	if len(got) != 5 || got[0] != 200 {
+		t.Fatalf("unexpected result %v", got)
+	}
+
+	report := metrics.Report()
+	if len(report) != 4 {
+		t.Fatalf("expect 4 stages, got %v", report)
+	}
+	expect := []StageMetrics{
+		{Index: 1, Stage: "Filter", In: 200, Out: 100},
+		{Index: 2, Stage: "Sort", In: 100, Out: 5},
+		{Index: 3, Stage: "Limit", In: 5, Out: 5, Cancelled: true},
+		{Index: 4, Stage: "Collect", In: 5},
+	}
+	for idx := range expect {
+		report[idx].Elapsed = 0
+		if report[idx] != expect[idx] {
+			t.Fatalf("expect %+v, got %+v", expect[idx], report[idx])
+		}
+	}
+	if !strings.Contains(metrics.String(), "Limit (cancelled)") {
+		t.Fatalf("unexpected report:\n%s", metrics)
+	}
+	if recorder.counts[EventBegin] != 4 || recorder.counts[EventEnd] != 4 || recorder.counts[EventAccept] != 310 {
+		t.Fatalf("unexpected event counts %v", recorder.counts)
+	}
+}
+
+func TestWithObserverReturnsStage(t *testing.T) {
+	s := Of(3, 1, 2).Sort(func(a interface{}, b interface{}) int {
+		return a.(int) - b.(int)
+	})
+	metrics := NewMetricsCollector()
+	observed := s.WithObserver(metrics)
+	if observed != s {
+		t.Fatalf("expect the Sort stage returned, got %T", observed)
+	}
+	if got := observed.Collect(); len(got) != 3 || got[0] != 1 || len(metrics.Report()) != 2 {
+		t.Fatalf("unexpected result %v, report %v", got, metrics.Report())
+	}
+}
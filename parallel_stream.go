@@ -5,6 +5,8 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type parallelStage struct {
@@ -24,6 +26,7 @@ func (p *parallelStage) begin(size int) {
 	} else {
 		p.pumper = make(chan interface{})
 	}
+	p.downStream.begin(size)
 	p.startLoops(size)
 }
 
@@ -70,3 +73,84 @@ func GoID() int {
 	}
 	return id
 }
+
+// partitionBufferSize is the channel buffer of each partition worker
+const partitionBufferSize = 16
+
+// partitionStage sends each element to a fixed worker chosen by the hash of its key,
+// so elements of the same key are passed to next stage in order by the same goroutine.
+// Workers pass elements to next stage one at a time, so the stages after it, terminals
+// included, are never called concurrently
+type partitionStage struct {
+	baseStage
+	keyFunc KeyFunc
+	workers []chan interface{}
+	wg      sync.WaitGroup
+	out     sync.Mutex // serializes calls to next stage
+	// panicked is the first panic of the stages after it, it is raised again by end
+	// on the calling goroutine, and the workers drop elements once it is set
+	panicked  interface{}
+	panicking int32
+}
+
+func (p *partitionStage) begin(size int) {
+	p.downStream.begin(size)
+	for idx := range p.workers {
+		p.workers[idx] = make(chan interface{}, partitionBufferSize)
+		p.wg.Add(1)
+		go p.work(p.workers[idx])
+	}
+}
+
+// work passes elements of a partition to next stage, it keeps draining the
+// partition after cancellation so that accept never blocks
+func (p *partitionStage) work(partition chan interface{}) {
+	defer p.wg.Done()
+	for v := range partition {
+		if p.Err() == nil && !p.stopRequested() {
+			p.pass(v)
+		}
+	}
+}
+
+func (p *partitionStage) pass(v interface{}) {
+	p.out.Lock()
+	defer p.out.Unlock()
+	if p.panicked != nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			p.panicked = r
+			atomic.StoreInt32(&p.panicking, 1)
+		}
+	}()
+	p.downStream.accept(v)
+}
+
+// accept drops elements once the stream is stopped, and stops waiting for a full
+// partition whose worker may be stuck in the stages after it once the stream is cancelled
+func (p *partitionStage) accept(t interface{}) {
+	if p.Err() != nil || p.cancellationRequested() {
+		return
+	}
+	select {
+	case p.workers[hashValue(p.keyFunc(t))%uint64(len(p.workers))] <- t:
+	case <-p.startStage.cancellation():
+	}
+}
+
+func (p *partitionStage) cancellationRequested() bool {
+	return atomic.LoadInt32(&p.panicking) == 1 || p.stopRequested()
+}
+
+func (p *partitionStage) end() {
+	for idx := range p.workers {
+		close(p.workers[idx])
+	}
+	p.wg.Wait()
+	if p.panicked != nil {
+		panic(p.panicked)
+	}
+	p.downStream.end()
+}
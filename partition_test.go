@@ -0,0 +1,177 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type purchase struct {
+	customer int
+	seq      int
+}
+
+func purchases(customers, perCustomer int) []interface{} {
+	data := make([]interface{}, 0, customers*perCustomer)
+	for seq := 0; seq < perCustomer; seq++ {
+		for customer := 0; customer < customers; customer++ {
+			data = append(data, purchase{customer: customer, seq: seq})
+		}
+	}
+	return data
+}
+
+func customerOf(v interface{}) interface{} {
+	return v.(purchase).customer
+}
+
+func TestPartitionByPreservesKeyOrder(t *testing.T) {
+	var l sync.Mutex
+	seqs := make(map[int][]int)
+	routines := make(map[int]map[int]bool)
+	New(purchases(10, 100)).PartitionBy(customerOf, 4).Map(func(v interface{}) interface{} {
+		return v
+	}).ForEach(func(v interface{}) {
+		o := v.(purchase)
+		l.Lock()
+		defer l.Unlock()
+		seqs[o.customer] = append(seqs[o.customer], o.seq)
+		if routines[o.customer] == nil {
+			routines[o.customer] = make(map[int]bool)
+		}
+		routines[o.customer][GoID()] = true
+	})
+	all := make(map[int]bool)
+	for customer := 0; customer < 10; customer++ {
+		if len(seqs[customer]) != 100 {
+			t.Fatalf("customer %d: expect 100 orders, got %d", customer, len(seqs[customer]))
+		}
+		for idx, seq := range seqs[customer] {
+			if seq != idx {
+				t.Fatalf("customer %d: orders out of order %v", customer, seqs[customer])
+			}
+		}
+		if len(routines[customer]) != 1 {
+			t.Fatalf("customer %d: expect processed by one worker, got %d", customer, len(routines[customer]))
+		}
+		for id := range routines[customer] {
+			all[id] = true
+		}
+	}
+	if len(all) < 2 {
+		t.Fatalf("expect keys processed by several workers, got %d", len(all))
+	}
+}
+
+func TestPartitionByCancellation(t *testing.T) {
+	s := New(purchases(10, 100)).PartitionBy(customerOf, 4).Via(dedupe{})
+	plan := s.Explain()
+	if !strings.Contains(plan, "1. PartitionBy(4) stateless [sized nonnull] <parallel boundary>") {
+		t.Fatalf("unexpected plan:\n%s", plan)
+	}
+	var l sync.Mutex
+	count := 0
+	s.Limit(5).ForEach(func(_ interface{}) {
+		l.Lock()
+		count++
+		l.Unlock()
+	})
+	if count != 5 {
+		t.Fatalf("expect 5 elements, got %d", count)
+	}
+}
+
+// observerFunc adapts a function to Observer
+type observerFunc func(event StageEvent)
+
+func (f observerFunc) Observe(event StageEvent) {
+	f(event)
+}
+
+func TestPartitionByAcceptAfterCancellation(t *testing.T) {
+	// the only worker is stuck on the first element, the partition buffer is full when
+	// the element last arrives, which cancels the stream before it is accepted
+	last := partitionBufferSize + 2
+	data := make([]interface{}, 0, last+1)
+	for v := 1; v <= last+1; v++ {
+		data = append(data, v)
+	}
+	source := New(data)
+	start := source.(stage).getStartStage()
+	accepted, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	s := source.Map(func(v interface{}) interface{} {
+		if v.(int) == last {
+			start.cancel()
+		}
+		return v
+	}).PartitionBy(func(_ interface{}) interface{} {
+		return 0
+	}, 1).WithObserver(observerFunc(func(event StageEvent) {
+		if event.Type == EventAccept && event.Stage == "PartitionBy" && event.In == int64(last) {
+			close(accepted)
+		}
+	}))
+	go func() {
+		defer close(done)
+		s.ForEach(func(v interface{}) {
+			if v.(int) == 1 {
+				<-release
+			}
+		})
+	}()
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Error("accept blocked after cancellation")
+	}
+	close(release)
+	<-done
+	if !errors.Is(s.Err(), ErrCancelled) {
+		t.Fatalf("expect ErrCancelled, got %v", s.Err())
+	}
+}
+
+func TestPartitionByPanic(t *testing.T) {
+	s := Of(1, 2, 3).PartitionBy(func(v interface{}) interface{} {
+		return v
+	}, 2).Map(func(v interface{}) interface{} {
+		if v.(int) == 2 {
+			panic("boom")
+		}
+		return v
+	})
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Fatalf("expect panic raised on the calling goroutine, got %v", p)
+		}
+	}()
+	s.ForEach(func(_ interface{}) {})
+}
+
+func TestPartitionByTerminals(t *testing.T) {
+	if got := New(purchases(10, 100)).PartitionBy(customerOf, 4).Collect(); len(got) != 1000 {
+		t.Fatalf("expect 1000 elements collected, got %d", len(got))
+	}
+	if got := New(purchases(10, 100)).PartitionBy(customerOf, 4).Count(); got != 1000 {
+		t.Fatalf("expect 1000 elements counted, got %d", got)
+	}
+}
+
+func TestPartitionByNegativeZero(t *testing.T) {
+	zero := 0.0
+	if hashValue(-zero) != hashValue(zero) || hashValue(float32(-zero)) != hashValue(float32(zero)) {
+		t.Fatal("expect -0 hashed as 0")
+	}
+	routines := make(map[bool]int)
+	New([]float64{zero, -zero}).PartitionBy(func(v interface{}) interface{} {
+		return v
+	}, 16).ForEach(func(v interface{}) {
+		routines[math.Signbit(v.(float64))] = GoID()
+	})
+	if routines[false] != routines[true] {
+		t.Fatalf("expect 0 and -0 processed by one worker, got %v", routines)
+	}
+}
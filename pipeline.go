@@ -0,0 +1,262 @@
+package stream
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Pipeline describes a chain of intermediate operations independent of data,
+// it can be applied to any number of Streams by Run. Pipeline is immutable,
+// every method returns a new Pipeline, so a Pipeline can be branched safely
+//
+//	evens := NewPipeline().Filter(isEven)
+//	doubled := evens.Map(double)
+//	squared := evens.Map(square) // does not affect doubled
+//	doubled.Run(New(batch)).Collect()
+type Pipeline struct {
+	ops []func(Stream) Stream
+}
+
+// NewPipeline creates an empty Pipeline, which returns the Stream as it is
+func NewPipeline() Pipeline {
+	return Pipeline{}
+}
+
+// Then appends an arbitrary operation to the Pipeline
+func (p Pipeline) Then(op func(Stream) Stream) Pipeline {
+	ops := make([]func(Stream) Stream, len(p.ops), len(p.ops)+1)
+	copy(ops, p.ops)
+	return Pipeline{ops: append(ops, op)}
+}
+
+// Concat appends all operations of other to the Pipeline
+func (p Pipeline) Concat(other Pipeline) Pipeline {
+	ops := make([]func(Stream) Stream, 0, len(p.ops)+len(other.ops))
+	ops = append(ops, p.ops...)
+	return Pipeline{ops: append(ops, other.ops...)}
+}
+
+// Run applies operations of the Pipeline to s in order, and returns the
+// resulting Stream on which a terminal operation can be called
+func (p Pipeline) Run(s Stream) Stream {
+	for _, op := range p.ops {
+		s = op(s)
+	}
+	return s
+}
+
+func (p Pipeline) Filter(filter FilterFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Filter(filter)
+	})
+}
+
+func (p Pipeline) Map(mapper MapFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Map(mapper)
+	})
+}
+
+func (p Pipeline) FlatMap(mapper FlatMapFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.FlatMap(mapper)
+	})
+}
+
+func (p Pipeline) Distinct() Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Distinct()
+	})
+}
+
+func (p Pipeline) DistinctByFunc(fn DistinctFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.DistinctByFunc(fn)
+	})
+}
+
+func (p Pipeline) Skip(n int) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Skip(n)
+	})
+}
+
+func (p Pipeline) Limit(n int) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Limit(n)
+	})
+}
+
+func (p Pipeline) Sort(comparator ComparatorFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Sort(comparator)
+	})
+}
+
+func (p Pipeline) SortWith(comparator ComparatorFunc, opts SortOptions) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.SortWith(comparator, opts)
+	})
+}
+
+// Sample samples the Stream of each Run with a rand.Rand created by newRand, so that
+// concurrent Runs do not share one, a time seeded one is used if newRand is nil
+func (p Pipeline) Sample(k int, newRand func() *rand.Rand) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Sample(k, randOf(newRand))
+	})
+}
+
+// SampleFraction samples the Stream of each Run with a rand.Rand created by newRand
+func (p Pipeline) SampleFraction(fraction float64, newRand func() *rand.Rand) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.SampleFraction(fraction, randOf(newRand))
+	})
+}
+
+// Shuffle shuffles the Stream of each Run with a rand.Rand created by newRand
+func (p Pipeline) Shuffle(newRand func() *rand.Rand) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Shuffle(randOf(newRand))
+	})
+}
+
+// randOf creates a rand.Rand by newRand, or returns nil for the stream to create one
+func randOf(newRand func() *rand.Rand) *rand.Rand {
+	if newRand == nil {
+		return nil
+	}
+	return newRand()
+}
+
+func (p Pipeline) Group(grouper GroupFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Group(grouper)
+	})
+}
+
+func (p Pipeline) MapAsync(concurrency int, fn AsyncMapFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.MapAsync(concurrency, fn)
+	})
+}
+
+func (p Pipeline) MapAsyncOrdered(concurrency int, fn AsyncMapFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.MapAsyncOrdered(concurrency, fn)
+	})
+}
+
+func (p Pipeline) MapWithRetry(fn AsyncMapFunc, policy RetryPolicy) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.MapWithRetry(fn, policy)
+	})
+}
+
+func (p Pipeline) OnErrorReturn(fn ErrorReturnFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.OnErrorReturn(fn)
+	})
+}
+
+func (p Pipeline) OnErrorResume(fn ErrorResumeFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.OnErrorResume(fn)
+	})
+}
+
+func (p Pipeline) RateLimit(n int, per time.Duration) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.RateLimit(n, per)
+	})
+}
+
+func (p Pipeline) Throttle(interval time.Duration) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Throttle(interval)
+	})
+}
+
+func (p Pipeline) Debounce(quiet time.Duration) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Debounce(quiet)
+	})
+}
+
+func (p Pipeline) Delay(d time.Duration) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Delay(d)
+	})
+}
+
+func (p Pipeline) TumblingWindow(size time.Duration, opts WindowOptions) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.TumblingWindow(size, opts)
+	})
+}
+
+func (p Pipeline) SlidingWindow(size time.Duration, slide time.Duration, opts WindowOptions) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.SlidingWindow(size, slide, opts)
+	})
+}
+
+func (p Pipeline) SessionWindow(gap time.Duration, opts WindowOptions) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.SessionWindow(gap, opts)
+	})
+}
+
+func (p Pipeline) PartitionBy(key KeyFunc, workers int) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.PartitionBy(key, workers)
+	})
+}
+
+func (p Pipeline) Parallel() Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Parallel()
+	})
+}
+
+// Join joins the Stream with the one created by other on each Run,
+// since a Stream can only be run once
+func (p Pipeline) Join(other func() Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Join(other(), leftKey, rightKey, combine)
+	})
+}
+
+// LeftJoin left joins the Stream with the one created by other on each Run
+func (p Pipeline) LeftJoin(other func() Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.LeftJoin(other(), leftKey, rightKey, combine)
+	})
+}
+
+// RightJoin right joins the Stream with the one created by other on each Run
+func (p Pipeline) RightJoin(other func() Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.RightJoin(other(), leftKey, rightKey, combine)
+	})
+}
+
+// FullOuterJoin full outer joins the Stream with the one created by other on each Run
+func (p Pipeline) FullOuterJoin(other func() Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.FullOuterJoin(other(), leftKey, rightKey, combine)
+	})
+}
+
+// CoGroup groups the Stream with the one created by other on each Run
+func (p Pipeline) CoGroup(other func() Stream, leftKey KeyFunc, rightKey KeyFunc) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.CoGroup(other(), leftKey, rightKey)
+	})
+}
+
+func (p Pipeline) Via(op Operator) Pipeline {
+	return p.Then(func(s Stream) Stream {
+		return s.Via(op)
+	})
+}
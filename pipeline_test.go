@@ -0,0 +1,163 @@
+package stream
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	evens := NewPipeline().Filter(func(v interface{}) bool {
+		return v.(int)%2 == 0
+	})
+	doubled := evens.Map(func(v interface{}) interface{} {
+		return v.(int) * 2
+	})
+	negated := evens.Map(func(v interface{}) interface{} {
+		return -v.(int)
+	})
+
+	for _, batch := range [][]int{{1, 2, 3, 4}, {6}} {
+		got := doubled.Run(New(batch)).Collect()
+		if got[len(got)-1] != batch[len(batch)-1]*2 {
+			t.Fatalf("unexpected doubled result %v", got)
+		}
+	}
+	if got := negated.Run(Of(1, 2, 3, 4)).Collect(); len(got) != 2 || got[1] != -4 {
+		t.Fatalf("unexpected negated result %v", got)
+	}
+	if got := evens.Concat(doubled).Limit(1).Run(Of(2, 4)).Collect(); len(got) != 1 || got[0] != 4 {
+		t.Fatalf("unexpected concat result %v", got)
+	}
+}
+
+func TestPipelineOperations(t *testing.T) {
+	identity := func(v interface{}) interface{} { return v }
+	other := func() Stream { return Of(2, 3, 4, 6) }
+	combine := func(l interface{}, r interface{}) interface{} {
+		res := 0
+		if l != nil {
+			res += l.(int) * 10
+		}
+		if r != nil {
+			res += r.(int)
+		}
+		return res
+	}
+	summary := func(v interface{}) interface{} {
+		g := v.(CoGroupResult)
+		return g.Key.(int)*100 + len(g.Left)*10 + len(g.Right)
+	}
+	cases := []struct {
+		name   string
+		p      Pipeline
+		expect [2][]int // results of source 1, 2, 3, 4 and source 3, 5
+	}{
+		{"join", NewPipeline().Join(other, identity, identity, combine), [2][]int{{22, 33, 44}, {33}}},
+		{"left join", NewPipeline().LeftJoin(other, identity, identity, combine), [2][]int{{10, 22, 33, 44}, {33, 50}}},
+		{"right join", NewPipeline().RightJoin(other, identity, identity, combine), [2][]int{{6, 22, 33, 44}, {2, 4, 6, 33}}},
+		{"full outer join", NewPipeline().FullOuterJoin(other, identity, identity, combine), [2][]int{{6, 10, 22, 33, 44}, {2, 4, 6, 33, 50}}},
+		{"co-group", NewPipeline().CoGroup(other, identity, identity).Map(summary), [2][]int{{110, 211, 311, 411, 601}, {201, 311, 401, 510, 601}}},
+		{"via", NewPipeline().Via(dedupe{}), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+	}
+	for _, c := range cases {
+		sources := []Stream{Of(1, 2, 3, 4), Of(3, 5), Of(1, 2, 3, 4).Tee(1)[0]}
+		expects := [][]int{c.expect[0], c.expect[1], c.expect[0]}
+		for idx, source := range sources {
+			if got := sortedInts(c.p.Run(source).Collect()); !equalInts(got, expects[idx]) {
+				t.Errorf("%s on source %d: expect %v, got %v", c.name, idx, expects[idx], got)
+			}
+		}
+	}
+}
+
+// sortedInts converts int elements to a sorted []int
+func sortedInts(data []interface{}) []int {
+	res := make([]int, 0, len(data))
+	for _, v := range data {
+		res = append(res, v.(int))
+	}
+	sort.Ints(res)
+	return res
+}
+
+func TestPipelineMatchesStream(t *testing.T) {
+	identity := func(v interface{}) interface{} { return v }
+	asyncIdentity := func(v interface{}) (interface{}, error) { return v, nil }
+	twice := func(v interface{}) []interface{} { return []interface{}{v, v} }
+	desc := func(a interface{}, b interface{}) int { return b.(int) - a.(int) }
+	parity := func(v interface{}) interface{} { return v.(int) % 2 }
+	size := func(v interface{}) interface{} {
+		if w, ok := v.(Window); ok {
+			return len(w.Elements)
+		}
+		return len(v.([]interface{}))
+	}
+	seeded := func() *rand.Rand { return rand.New(rand.NewSource(1)) }
+	seconds := WindowOptions{Timestamp: func(v interface{}) time.Time { return time.Unix(int64(v.(int)), 0) }}
+	cases := []struct {
+		name   string
+		p      Pipeline
+		expect [2][]int // results of source 1, 2, 3, 4 and source 3, 5
+	}{
+		{"filter", NewPipeline().Filter(func(v interface{}) bool { return v.(int)%2 == 1 }), [2][]int{{1, 3}, {3, 5}}},
+		{"map", NewPipeline().Map(func(v interface{}) interface{} { return v.(int) * 2 }), [2][]int{{2, 4, 6, 8}, {6, 10}}},
+		{"flat map", NewPipeline().FlatMap(twice), [2][]int{{1, 1, 2, 2, 3, 3, 4, 4}, {3, 3, 5, 5}}},
+		{"distinct", NewPipeline().FlatMap(twice).Distinct(), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"distinct by func", NewPipeline().DistinctByFunc(parity), [2][]int{{3, 4}, {5}}},
+		{"skip", NewPipeline().Skip(1), [2][]int{{2, 3, 4}, {5}}},
+		{"limit", NewPipeline().Limit(1), [2][]int{{1}, {3}}},
+		{"sort", NewPipeline().Sort(desc).Limit(1), [2][]int{{4}, {5}}},
+		{"sort with", NewPipeline().SortWith(desc, SortOptions{}).Limit(1), [2][]int{{4}, {5}}},
+		{"sample", NewPipeline().Sample(10, seeded), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"sample fraction", NewPipeline().SampleFraction(1, seeded), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"shuffle", NewPipeline().Shuffle(seeded), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"group", NewPipeline().Group(parity).Map(size), [2][]int{{2, 2}, {2}}},
+		{"map async", NewPipeline().MapAsync(2, asyncIdentity), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"map async ordered", NewPipeline().MapAsyncOrdered(2, asyncIdentity), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"map with retry", NewPipeline().MapWithRetry(asyncIdentity, RetryPolicy{}), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"on error return", NewPipeline().OnErrorReturn(func(error) interface{} { return -1 }), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"on error resume", NewPipeline().OnErrorResume(func(error) Stream { return Of(-1) }), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"rate limit", NewPipeline().RateLimit(1, time.Second), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"throttle", NewPipeline().Throttle(time.Second), [2][]int{{1}, {3}}},
+		{"debounce", NewPipeline().Debounce(time.Second), [2][]int{{4}, {5}}},
+		{"delay", NewPipeline().Delay(time.Second), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"tumbling window", NewPipeline().TumblingWindow(10*time.Second, seconds).Map(size), [2][]int{{4}, {2}}},
+		{"sliding window", NewPipeline().SlidingWindow(10*time.Second, 5*time.Second, seconds).Map(size), [2][]int{{4, 4}, {1, 1, 2}}},
+		{"session window", NewPipeline().SessionWindow(2*time.Second, seconds).Map(size), [2][]int{{4}, {1, 1}}},
+		{"partition by", NewPipeline().PartitionBy(parity, 2).Sort(desc), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+		{"parallel", NewPipeline().Parallel().Map(identity).Sort(desc), [2][]int{{1, 2, 3, 4}, {3, 5}}},
+	}
+	for _, c := range cases {
+		sources := []Stream{Of(1, 2, 3, 4), Of(3, 5), Of(1, 2, 3, 4).Tee(1)[0]}
+		expects := [][]int{c.expect[0], c.expect[1], c.expect[0]}
+		for idx, source := range sources {
+			if got := sortedInts(c.p.Run(source.WithClock(newFakeClock())).Collect()); !equalInts(got, expects[idx]) {
+				t.Errorf("%s on source %d: expect %v, got %v", c.name, idx, expects[idx], got)
+			}
+		}
+	}
+}
+
+func TestPipelineConcurrentRuns(t *testing.T) {
+	seeded := func() *rand.Rand { return rand.New(rand.NewSource(1)) }
+	p := NewPipeline().Shuffle(seeded).SampleFraction(0.5, seeded).Sample(50, seeded)
+	results := make([][]interface{}, 8)
+	var wg sync.WaitGroup
+	for idx := range results {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			results[idx] = p.Run(New(dataGenerator())).Collect()
+		}(idx)
+	}
+	wg.Wait()
+	for idx := range results {
+		if len(results[idx]) == 0 || !reflect.DeepEqual(results[idx], results[0]) {
+			t.Fatalf("expect every Run sampled alike, got %v and %v", results[idx], results[0])
+		}
+	}
+}
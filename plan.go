@@ -0,0 +1,360 @@
+package stream
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type opKind int
+
+const (
+	kindSource opKind = iota
+	kindStateless
+	kindStateful
+	kindTerminal
+)
+
+func (k opKind) String() string {
+	switch k {
+	case kindSource:
+		return "source"
+	case kindStateless:
+		return "stateless"
+	case kindStateful:
+		return "stateful"
+	default:
+		return "terminal"
+	}
+}
+
+// Characteristics describes the data a stage passes to next stage, stages use them to
+// pick a cheaper way of processing data, e.g. a Distinct on DISTINCT data does nothing
+type Characteristics uint8
+
+const (
+	// Sized means the size passed to begin is the exact count of data, otherwise it is
+	// an estimate and non-positive value means unknown
+	Sized Characteristics = 1 << iota
+	// Ordered means data is sent in a defined order
+	Ordered
+	// Distinct means no two elements are equal
+	Distinct
+	// Sorted means data is sent in the order of a comparator
+	Sorted
+	// NonNull means no element is nil
+	NonNull
+)
+
+var characteristicNames = []string{"sized", "ordered", "distinct", "sorted", "nonnull"}
+
+func (c Characteristics) String() string {
+	names := make([]string, 0, len(characteristicNames))
+	for idx, name := range characteristicNames {
+		if c&(1<<idx) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// opInfo describes an operation, clears and sets decide how it changes Characteristics of upstream
+type opInfo struct {
+	name   string
+	kind   opKind
+	clears Characteristics
+	sets   Characteristics
+}
+
+var opInfos = map[streamer]opInfo{
+	opFilter:                {name: "Filter", kind: kindStateless, clears: Sized},
+	opMapper:                {name: "Map", kind: kindStateless, clears: Distinct | Sorted | NonNull},
+	opFlatMapper:            {name: "FlatMap", kind: kindStateless, clears: Sized | Distinct | Sorted | NonNull},
+	opSkipper:               {name: "Skip", kind: kindStateful},
+	opLimiter:               {name: "Limit", kind: kindStateful},
+	opSorter:                {name: "Sort", kind: kindStateful, sets: Sized | Ordered | Sorted},
+	OpGrouper:               {name: "Group", kind: kindStateful, clears: Ordered | Distinct | Sorted, sets: Sized | NonNull},
+	OpParalleled:            {name: "Parallel", kind: kindStateless, clears: Ordered | Sorted},
+	opCollector:             {name: "Collect", kind: kindTerminal},
+	opDistincter:            {name: "Distinct", kind: kindStateful, clears: Ordered | Sorted, sets: Sized | Distinct},
+	opLooper:                {name: "ForEach", kind: kindTerminal},
+	opMaximizer:             {name: "Max", kind: kindTerminal},
+	opMinimizer:             {name: "Min", kind: kindTerminal},
+	opCounter:               {name: "Count", kind: kindTerminal},
+	opFirst:                 {name: "First", kind: kindTerminal},
+	opLast:                  {name: "Last", kind: kindTerminal},
+	opFuncDistincter:        {name: "DistinctByFunc", kind: kindStateful, clears: Ordered | Sorted, sets: Sized | Distinct},
+	opReduce:                {name: "Reduce", kind: kindTerminal},
+	opExternalSorter:        {name: "SortWith", kind: kindStateful, sets: Sized | Ordered | Sorted},
+	opJoiner:                {name: "Join", kind: kindStateful, clears: Sized | Ordered | Distinct | Sorted | NonNull},
+	opCoGrouper:             {name: "CoGroup", kind: kindStateful, clears: Distinct | Sorted, sets: Sized | NonNull},
+	opSampler:               {name: "Sample", kind: kindStateful, clears: Ordered | Sorted, sets: Sized},
+	opFractionSampler:       {name: "SampleFraction", kind: kindStateless, clears: Sized},
+	opShuffler:              {name: "Shuffle", kind: kindStateful, clears: Ordered | Sorted, sets: Sized},
+	opApproxDistinctCounter: {name: "ApproxCountDistinct", kind: kindTerminal},
+	opApproxQuantiler:       {name: "ApproxQuantiles", kind: kindTerminal},
+	opApproxTopFrequenter:   {name: "ApproxTopFrequent", kind: kindTerminal},
+	opCSVWriter:             {name: "ToCSV", kind: kindTerminal},
+	opJSONLinesWriter:       {name: "ToJSONLines", kind: kindTerminal},
+	opMapCollector:          {name: "ToMap", kind: kindTerminal},
+	opSQLBatchWriter:        {name: "ToSQLBatches", kind: kindTerminal},
+	opChannelSender:         {name: "ToChannel", kind: kindTerminal},
+	opTee:                   {name: "Tee", kind: kindTerminal},
+	opOperator:              {name: "Via", kind: kindStateful},
+	opInto:                  {name: "Into", kind: kindTerminal},
+	opRateLimiter:           {name: "RateLimit", kind: kindStateless},
+	opThrottler:             {name: "Throttle", kind: kindStateless, clears: Sized},
+	opDebouncer:             {name: "Debounce", kind: kindStateful, clears: Sized},
+	opDelayer:               {name: "Delay", kind: kindStateless},
+	opTumblingWindower:      {name: "TumblingWindow", kind: kindStateful, clears: Sized | Distinct | Sorted, sets: Ordered | NonNull},
+	opSlidingWindower:       {name: "SlidingWindow", kind: kindStateful, clears: Sized | Distinct | Sorted, sets: Ordered | NonNull},
+	opAsyncMapper:           {name: "MapAsync", kind: kindStateless, clears: Sized | Ordered | Distinct | Sorted | NonNull},
+	opOrderedAsyncMapper:    {name: "MapAsyncOrdered", kind: kindStateless, clears: Sized | Distinct | Sorted | NonNull},
+	opRetryMapper:           {name: "MapWithRetry", kind: kindStateless, clears: Sized | Distinct | Sorted | NonNull},
+	opErrorReturner:         {name: "OnErrorReturn", kind: kindStateful, clears: Sized | Distinct | Sorted | NonNull},
+	opErrorResumer:          {name: "OnErrorResume", kind: kindStateful, clears: Sized | Distinct | Sorted | NonNull},
+	opPartitioner:           {name: "PartitionBy", kind: kindStateless, clears: Ordered | Sorted},
+	opSessionWindower:       {name: "SessionWindow", kind: kindStateful, clears: Sized | Distinct | Sorted, sets: Ordered | NonNull},
+}
+
+// planNode is the description of a stage in the execution plan of a stream. input is the
+// Characteristics of data the stage receives, and characteristics is of data it sends,
+// concurrent means the stage may be called concurrently since it runs after Parallel,
+// and skipped means the stage passes data through since its work is unnecessary
+type planNode struct {
+	name            string
+	kind            opKind
+	params          string
+	input           Characteristics
+	characteristics Characteristics
+	concurrent      bool
+	skipped         bool
+}
+
+func newPlanNode(s streamer, upstream *planNode, callback []interface{}) *planNode {
+	info, ok := opInfos[s]
+	if !ok {
+		panic(fmt.Sprintf("unknown op %v", s))
+	}
+	return &planNode{
+		name:            info.name,
+		kind:            info.kind,
+		params:          formatParams(callback),
+		input:           upstream.characteristics,
+		characteristics: upstream.characteristics&^info.clears | info.sets,
+		concurrent:      upstream.concurrent || s == OpParalleled,
+	}
+}
+
+// characterized is implemented by sources which know the Characteristics of their data,
+// sources without it are treated as ordered ones, and sized if size is positive
+type characterized interface {
+	characteristics() Characteristics
+}
+
+func newSourceNode(src source) *planNode {
+	node := &planNode{name: "Source", kind: kindSource, characteristics: Ordered}
+	if c, ok := src.(characterized); ok {
+		node.characteristics = c.characteristics()
+	} else if src.size() > 0 {
+		node.characteristics |= Sized
+	}
+	if node.characteristics&Sized != 0 {
+		node.params = fmt.Sprintf("size=%d", src.size())
+	}
+	return node
+}
+
+// formatParams prints parameters of basic kinds, functions and references are omitted
+func formatParams(callback []interface{}) string {
+	params := make([]string, 0, len(callback))
+	for _, param := range callback {
+		if param == nil {
+			continue
+		}
+		switch reflect.TypeOf(param).Kind() {
+		case reflect.Func, reflect.Ptr, reflect.Interface, reflect.Chan, reflect.Map, reflect.Slice:
+			continue
+		}
+		params = append(params, fmt.Sprintf("%+v", param))
+	}
+	return strings.Join(params, ", ")
+}
+
+func (p *planNode) String() string {
+	var b strings.Builder
+	b.WriteString(p.name)
+	if p.params != "" {
+		fmt.Fprintf(&b, "(%s)", p.params)
+	}
+	fmt.Fprintf(&b, " %s", p.kind)
+	if p.kind != kindTerminal {
+		fmt.Fprintf(&b, " [%s]", p.characteristics)
+	}
+	return b.String()
+}
+
+// chainOf returns all the stages linked after start, start included
+func chainOf(start *startOp) []stage {
+	chain := []stage{start}
+	for {
+		next := chain[len(chain)-1].getNextSink()
+		if observed, ok := next.(*observedSink); ok {
+			next = observed.inner
+		}
+		nextStage, ok := next.(stage)
+		if !ok {
+			return chain
+		}
+		chain = append(chain, nextStage)
+	}
+}
+
+// fusible reports whether a stage is a stateless one which could be fused with its neighbours
+func fusible(s stage) bool {
+	switch s.(type) {
+	case *filterOp, *mapperOp:
+		return true
+	}
+	return false
+}
+
+// fusionRuns finds runs of at least two adjacent fusible stages in chain,
+// each run is returned as [start, end) indexes of chain
+func fusionRuns(chain []stage) [][2]int {
+	runs := make([][2]int, 0)
+	for idx := 0; idx < len(chain); {
+		end := idx
+		for end < len(chain) && fusible(chain[end]) {
+			end++
+		}
+		if end-idx >= 2 {
+			runs = append(runs, [2]int{idx, end})
+		}
+		if end == idx {
+			end++
+		}
+		idx = end
+	}
+	return runs
+}
+
+// fuse replaces every run of adjacent Filter and Map stages with a single fusedOp,
+// so that an element goes through the run with one virtual call
+func fuse(start *startOp) {
+	chain := chainOf(start)
+	for _, run := range fusionRuns(chain) {
+		fused := &fusedOp{}
+		names := make([]string, 0, run[1]-run[0])
+		for _, s := range chain[run[0]:run[1]] {
+			switch op := s.(type) {
+			case *filterOp:
+				fused.steps = append(fused.steps, fusedStep{filter: op.filterFunc})
+			case *mapperOp:
+				fused.steps = append(fused.steps, fusedStep{mapper: op.mapperFunc})
+			}
+			names = append(names, s.getNode().name)
+		}
+		last := chain[run[1]-1]
+		fused.node = &planNode{
+			name:            strings.Join(names, "+"),
+			kind:            kindStateless,
+			input:           chain[run[0]].getNode().input,
+			characteristics: last.getNode().characteristics,
+			concurrent:      last.getNode().concurrent,
+		}
+		fused.setStartStage(start)
+		fused.setNextSink(last.getNextSink())
+		chain[run[0]-1].setNextSink(fused)
+	}
+}
+
+// isSorter reports whether a stage sorts data
+func isSorter(s stage) bool {
+	switch s.(type) {
+	case *sorterOp, *externalSorterOp:
+		return true
+	}
+	return false
+}
+
+// skipSupersededSorts marks a sort directly followed by a Sort in chain as skipped, since Sort
+// is not stable and replaces its order. A sort followed by the stable SortWith is kept, which
+// breaks ties in that order. It is decided on the chain which runs rather than when the
+// stages are built, because a stage may be followed by several branches until it runs
+func skipSupersededSorts(chain []stage) {
+	for idx, s := range chain {
+		if !isSorter(s) {
+			continue
+		}
+		s.getNode().skipped = false
+		if idx+1 < len(chain) {
+			_, s.getNode().skipped = chain[idx+1].(*sorterOp)
+		}
+	}
+}
+
+// explain prints the execution plan of stages linked after start until last
+func explain(start *startOp, last stage) string {
+	chain := chainOf(start)
+	for idx, s := range chain {
+		if s == last {
+			chain = chain[:idx+1]
+			break
+		}
+	}
+	skipSupersededSorts(chain)
+	fusedInto := make(map[int]string)
+	for _, run := range fusionRuns(chain) {
+		names := make([]string, 0, run[1]-run[0])
+		for _, s := range chain[run[0]:run[1]] {
+			names = append(names, s.getNode().name)
+		}
+		for idx := run[0]; idx < run[1]; idx++ {
+			fusedInto[idx] = strings.Join(names, "+")
+		}
+	}
+	var b strings.Builder
+	for idx, s := range chain {
+		fmt.Fprintf(&b, "%d. %s", idx, s.getNode())
+		if name, ok := fusedInto[idx]; ok {
+			fmt.Fprintf(&b, " fused into %s", name)
+		}
+		if s.getNode().skipped {
+			b.WriteString(" skipped")
+		}
+		switch s.(type) {
+		case *parallelStage, *partitionStage:
+			b.WriteString(" <parallel boundary>")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+type fusedStep struct {
+	filter FilterFunc
+	mapper MapFunc
+}
+
+// fusedOp performs a run of Filter and Map stages in order
+type fusedOp struct {
+	baseStage
+	steps []fusedStep
+}
+
+func (f *fusedOp) accept(t interface{}) {
+	if f.stopRequested() {
+		return
+	}
+	for _, step := range f.steps {
+		if step.filter != nil {
+			if !step.filter(t) {
+				return
+			}
+		} else {
+			t = step.mapper(t)
+		}
+	}
+	f.downStream.accept(t)
+}
@@ -0,0 +1,195 @@
+package stream
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	s := New(dataGenerator()).Filter(func(v interface{}) bool {
+		return v.(int)%2 == 0
+	}).Map(func(v interface{}) interface{} {
+		return v.(int) * 3
+	}).Parallel().Skip(3)
+	plan := s.Explain()
+	for _, expect := range []string{
+		"0. Source(size=200) source [sized ordered nonnull]",
+		"1. Filter stateless [ordered nonnull] fused into Filter+Map",
+		"3. Parallel stateless [] <parallel boundary>",
+		"4. Skip(3) stateful []",
+	} {
+		if !strings.Contains(plan, expect) {
+			t.Fatalf("expect %q in plan:\n%s", expect, plan)
+		}
+	}
+}
+
+func TestFusedStages(t *testing.T) {
+	s := Of(1, 2, 3, 4, 5, 6).Map(func(v interface{}) interface{} {
+		return v.(int) + 1
+	}).Filter(func(v interface{}) bool {
+		return v.(int)%2 == 0
+	}).Map(func(v interface{}) interface{} {
+		return v.(int) * 10
+	})
+	got := s.Limit(2).Collect()
+	if len(got) != 2 || got[0] != 20 || got[1] != 40 {
+		t.Fatalf("unexpected result %v", got)
+	}
+	if !strings.Contains(s.Explain(), "1. Map+Filter+Map stateless") {
+		t.Fatalf("expect stages fused after execution:\n%s", s.Explain())
+	}
+}
+
+func TestCharacteristics(t *testing.T) {
+	s := New(dataGenerator())
+	if s.Characteristics() != Sized|Ordered|NonNull {
+		t.Fatalf("unexpected source characteristics %v", s.Characteristics())
+	}
+	if c := Of(1, nil).Characteristics(); c != Sized|Ordered {
+		t.Fatalf("unexpected characteristics with nil element %v", c)
+	}
+	if c := s.Distinct().Characteristics(); c != Sized|Distinct|NonNull {
+		t.Fatalf("unexpected Distinct characteristics %v", c)
+	}
+	if c := Keys(map[int]int{1: 1}).Characteristics(); c != Sized|Distinct {
+		t.Fatalf("unexpected Keys characteristics %v", c)
+	}
+	sorted := Of(3, 1, 2).Sort(func(a, b interface{}) int {
+		return a.(int) - b.(int)
+	})
+	if c := sorted.Map(func(v interface{}) interface{} {
+		return v
+	}).Characteristics(); c != Sized|Ordered {
+		t.Fatalf("unexpected Map characteristics %v", c)
+	}
+}
+
+// sizeSink records the size passed to Begin
+type sizeSink struct {
+	size int
+}
+
+func (s *sizeSink) Begin(size int) {
+	s.size = size
+}
+
+func (s *sizeSink) Accept(_ interface{}) {}
+
+func (s *sizeSink) End() {}
+
+func (s *sizeSink) CancellationRequested() bool {
+	return false
+}
+
+func TestSizeHints(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		stream Stream
+		size   int
+	}{
+		{"skip all", New(dataGenerator()).Skip(300), 0},
+		{"skip", New(dataGenerator()).Skip(50), 150},
+		{"limit fewer", New(dataGenerator()).Limit(500), 200},
+		{"limit", New(dataGenerator()).Limit(5), 5},
+		{"filter estimate", New(dataGenerator()).Filter(func(v interface{}) bool {
+			return v.(int) > 100
+		}), 200},
+		{"distinct", Of(1, 1, 2).Distinct(), 2},
+		{"parallel", New(dataGenerator()).Parallel(), 200},
+	} {
+		sink := &sizeSink{size: -1}
+		if err := c.stream.Into(sink); err != nil {
+			t.Fatal(err)
+		}
+		if sink.size != c.size {
+			t.Errorf("%s: expect size %d, got %d", c.name, c.size, sink.size)
+		}
+	}
+}
+
+func TestCollectPreAllocates(t *testing.T) {
+	got := New(dataGenerator()).Limit(10).Collect()
+	if len(got) != 10 || cap(got) != 10 {
+		t.Fatalf("expect exactly allocated result, got len %d cap %d", len(got), cap(got))
+	}
+}
+
+func TestSkipUnnecessaryStages(t *testing.T) {
+	asc := func(a, b interface{}) int {
+		return a.(int) - b.(int)
+	}
+	desc := func(a, b interface{}) int {
+		return b.(int) - a.(int)
+	}
+	s := Of(3, 1, 2).Sort(asc).Sort(desc)
+	plan := s.Explain()
+	if !strings.Contains(plan, "1. Sort stateful [sized ordered sorted nonnull] skipped") ||
+		strings.Contains(plan, "2. Sort stateful [sized ordered sorted nonnull] skipped") {
+		t.Fatalf("expect only the first sort skipped:\n%s", plan)
+	}
+	if got := s.Collect(); got[0] != 3 || got[1] != 2 || got[2] != 1 {
+		t.Fatalf("unexpected result %v", got)
+	}
+
+	// a sort followed by a branch which is never run still sorts
+	sorted := Of(3, 1, 2).Sort(asc)
+	_ = sorted.Sort(desc)
+	if got := sorted.Collect(); got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Fatalf("expect sorted result of the branch which runs, got %v", got)
+	}
+	explained := Of(3, 1, 2).Sort(asc)
+	_ = explained.Sort(desc).Explain()
+	if strings.Contains(explained.Explain(), "skipped") {
+		t.Fatalf("expect no sort skipped:\n%s", explained.Explain())
+	}
+	if got := explained.Collect(); got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Fatalf("expect sorted result after Explain of another branch, got %v", got)
+	}
+
+	// a sort followed by the stable SortWith decides the order of ties
+	type kv struct{ K, V int }
+	byK := func(a, b interface{}) int { return a.(kv).K - b.(kv).K }
+	byV := func(a, b interface{}) int { return a.(kv).V - b.(kv).V }
+	stable := Of(kv{1, 3}, kv{0, 2}, kv{1, 1}, kv{0, 0}, kv{1, 2}, kv{0, 1}).Sort(byV).SortWith(byK, SortOptions{})
+	if strings.Contains(stable.Explain(), "skipped") {
+		t.Fatalf("expect no sort skipped before SortWith:\n%s", stable.Explain())
+	}
+	expect := []interface{}{kv{0, 0}, kv{0, 1}, kv{0, 2}, kv{1, 1}, kv{1, 2}, kv{1, 3}}
+	if got := stable.Collect(); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect %v, got %v", expect, got)
+	}
+
+	d := Of(3, 1, 2, 1).Distinct().Sort(asc).Distinct()
+	if !strings.Contains(d.Explain(), "3. Distinct stateful [sized ordered distinct sorted nonnull] skipped") {
+		t.Fatalf("expect Distinct on DISTINCT data skipped:\n%s", d.Explain())
+	}
+	if got := d.Collect(); len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Fatalf("unexpected result %v", got)
+	}
+	if got := Keys(map[int]bool{1: true, 2: true}).Distinct().Limit(1).Count(); got != 1 {
+		t.Fatalf("expect cancellation passed through skipped Distinct, got %d", got)
+	}
+}
+
+func TestErrorAwareMappersClearSized(t *testing.T) {
+	fn := func(v interface{}) (interface{}, error) {
+		if v.(int) == 2 {
+			return nil, errFlaky
+		}
+		return v, nil
+	}
+	for _, s := range []Stream{
+		Of(1, 2, 3).WithErrorStrategy(SkipAndCount()).MapAsync(2, fn),
+		Of(1, 2, 3).WithErrorStrategy(SkipAndCount()).MapAsyncOrdered(2, fn),
+		Of(1, 2, 3).WithErrorStrategy(SkipAndCount()).MapWithRetry(fn, RetryPolicy{}),
+	} {
+		if s.Characteristics()&Sized != 0 {
+			t.Fatalf("expect size unknown after a mapper which may drop elements:\n%s", s.Explain())
+		}
+		if got := sortedInts(s.Collect()); !equalInts(got, []int{1, 3}) {
+			t.Fatalf("expect [1 3], got %v", got)
+		}
+	}
+}
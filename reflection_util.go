@@ -1,8 +1,11 @@
 package stream
 
 import (
+	"encoding"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
 func isPtr(v interface{}) bool {
@@ -35,3 +38,114 @@ func appendSlice(in reflect.Value, slice reflect.Value) error {
 	slice.Set(reflect.Append(slice, in))
 	return nil
 }
+
+// toFloat64 converts numeric value to float64
+func toFloat64(v interface{}) (float64, error) {
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(val.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), nil
+	}
+	return 0, fmt.Errorf("%T is not a number", v)
+}
+
+// fieldInfo describes an exported struct field used for tabular mapping
+type fieldInfo struct {
+	name  string
+	index []int
+}
+
+// structFields lists exported fields of struct type t, the field name is taken from
+// tag with the given key if it exists, fields tagged with "-" are skipped
+func structFields(t reflect.Type, tagKey string) []fieldInfo {
+	fields := make([]fieldInfo, 0, t.NumField())
+	for idx := 0; idx < t.NumField(); idx++ {
+		f := t.Field(idx)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup(tagKey); ok {
+			if tag = strings.Split(tag, ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, fieldInfo{name: name, index: f.Index})
+	}
+	return fields
+}
+
+// structType returns the struct type of v, or the struct type v points to
+func structType(v interface{}) (reflect.Type, bool) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t, t.Kind() == reflect.Struct
+}
+
+// setString parses s into receiver according to the type of receiver
+func setString(s string, receiver reflect.Value) error {
+	if u, ok := receiver.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch receiver.Kind() {
+	case reflect.String:
+		receiver.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		receiver.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, receiver.Type().Bits())
+		if err != nil {
+			return err
+		}
+		receiver.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, receiver.Type().Bits())
+		if err != nil {
+			return err
+		}
+		receiver.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, receiver.Type().Bits())
+		if err != nil {
+			return err
+		}
+		receiver.SetFloat(f)
+	default:
+		return fmt.Errorf("cannot parse string into %v", receiver.Type())
+	}
+	return nil
+}
+
+// formatValue formats v into string, it is the reverse of setString
+func formatValue(v reflect.Value) string {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return ""
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
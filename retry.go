@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"math"
+	"time"
+)
+
+// BackoffFunc returns how long to wait before the given retry, retry starts from 1
+type BackoffFunc func(retry int) time.Duration
+
+// ExponentialBackoff waits base before the first retry and doubles the wait for each
+// following retry, a positive max caps the wait, which saturates at the longest Duration otherwise
+func ExponentialBackoff(base time.Duration, max time.Duration) BackoffFunc {
+	return func(retry int) time.Duration {
+		wait := base
+		for idx := 1; idx < retry && (max <= 0 || wait < max); idx++ {
+			if wait > math.MaxInt64/2 {
+				wait = math.MaxInt64
+				break
+			}
+			wait *= 2
+		}
+		if max > 0 && wait > max {
+			wait = max
+		}
+		return wait
+	}
+}
+
+// RetryPolicy decides how MapWithRetry retries a failed call
+type RetryPolicy struct {
+	// MaxAttempts is the maximum count of calls for an element, the first one included,
+	// an element is called once if it is not positive
+	MaxAttempts int
+	// Backoff returns the wait before each retry, retries happen at once if it is nil
+	Backoff BackoffFunc
+	// RetryIf reports whether an error is worth retrying, all errors are retried if it is nil
+	RetryIf func(err error) bool
+}
+
+// mapRetryOp calls the mapper until it succeeds or the policy gives up, the last error
+// of an element is handled by the ErrorStrategy of stream
+type mapRetryOp struct {
+	statefulOp
+	fn     AsyncMapFunc
+	policy RetryPolicy
+	clock  Clock
+	count  int // count of elements received
+}
+
+func (m *mapRetryOp) begin(size int) {
+	m.clock = m.startStage.getClock()
+	m.downStream.begin(size)
+}
+
+func (m *mapRetryOp) accept(t interface{}) {
+	m.l.Lock()
+	index := m.count
+	m.count++
+	m.l.Unlock()
+	if m.stopRequested() {
+		return
+	}
+	var res interface{}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if res, err = m.fn(t); err == nil {
+			break
+		}
+		if attempt >= m.policy.MaxAttempts || (m.policy.RetryIf != nil && !m.policy.RetryIf(err)) {
+			m.elementFailed(&ElementError{Index: index, Value: t, Err: err})
+			return
+		}
+		var wait time.Duration
+		if m.policy.Backoff != nil {
+			wait = m.policy.Backoff(attempt)
+		}
+		if !m.backoff(wait) {
+			return // the element is dropped like those received after stop
+		}
+	}
+	m.downStream.accept(res)
+}
+
+// backoff waits d before a retry, and returns false if the stream is cancelled during the wait,
+// or the stages after it requested to stop
+func (m *mapRetryOp) backoff(d time.Duration) bool {
+	return sleep(m.clock, d, m.startStage.cancellation()) && !m.stopRequested()
+}
+
+func (m *mapRetryOp) cancellationRequested() bool {
+	return m.stopRequested()
+}
+
+// onErrorOp handles the error which stopped the stages before it, the error is cleared
+// and replaced by a fallback value or the elements of a fallback stream. Errors of the
+// stages after it and the cancellation of stream are not handled
+type onErrorOp struct {
+	statefulOp
+	returnFn       ErrorReturnFunc
+	resumeFn       ErrorResumeFunc
+	downstreamFail bool
+}
+
+func (o *onErrorOp) accept(t interface{}) {
+	if o.Err() != nil {
+		return // upstream failed, elements still sent by parallel stages are dropped
+	}
+	o.downStream.accept(t)
+	if o.Err() != nil {
+		o.l.Lock()
+		o.downstreamFail = true
+		o.l.Unlock()
+	}
+}
+
+func (o *onErrorOp) cancellationRequested() bool {
+	return o.stopRequested()
+}
+
+func (o *onErrorOp) end() {
+	err := o.Err()
+	if err == nil || o.downstreamFail || o.startStage.isCancelled() {
+		o.downStream.end()
+		return
+	}
+	o.startStage.clearErr()
+	if o.returnFn != nil {
+		if !o.stopRequested() {
+			o.downStream.accept(o.returnFn(err))
+		}
+	} else if fallback := o.resumeFn(err); fallback != nil {
+		if err = fallback.Into(resumeSink{o.downStream}); err != nil {
+			o.fail(err)
+		}
+	}
+	o.downStream.end()
+}
+
+// resumeSink passes elements of a fallback stream to the stages after onErrorOp,
+// which have already begun and are ended by onErrorOp
+type resumeSink struct {
+	s sink
+}
+
+func (r resumeSink) Begin(_ int) {}
+
+func (r resumeSink) Accept(v interface{}) {
+	r.s.accept(v)
+}
+
+func (r resumeSink) End() {}
+
+func (r resumeSink) CancellationRequested() bool {
+	return r.s.cancellationRequested()
+}
@@ -0,0 +1,167 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errFlaky = errors.New("flaky")
+
+// failOn returns a mapper fails the first failures calls for each element in failures
+func failOn(failures map[interface{}]int, calls map[interface{}]int) AsyncMapFunc {
+	return func(v interface{}) (interface{}, error) {
+		calls[v]++
+		if calls[v] <= failures[v] {
+			return nil, errFlaky
+		}
+		return v, nil
+	}
+}
+
+func TestMapWithRetry(t *testing.T) {
+	c := newFakeClock()
+	start := c.Now()
+	calls := make(map[interface{}]int)
+	s := Of(1, 2, 3).WithClock(c).MapWithRetry(failOn(map[interface{}]int{2: 2}, calls), RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     ExponentialBackoff(100*time.Millisecond, 0),
+	})
+	got := s.Collect()
+	if !reflect.DeepEqual(got, []interface{}{1, 2, 3}) || s.Err() != nil {
+		t.Fatalf("unexpected result %v, error %v", got, s.Err())
+	}
+	if calls[2] != 3 {
+		t.Fatalf("expect 3 calls, got %d", calls[2])
+	}
+	if waited := c.Now().Sub(start); waited != 300*time.Millisecond {
+		t.Fatalf("expect 300ms backoff, got %v", waited)
+	}
+}
+
+func TestMapWithRetryGivesUp(t *testing.T) {
+	calls := make(map[interface{}]int)
+	s := Of(1, 2, 3, 4).MapWithRetry(failOn(map[interface{}]int{3: 5}, calls), RetryPolicy{MaxAttempts: 2})
+	got := s.Collect()
+	if !reflect.DeepEqual(got, []interface{}{1, 2}) || calls[3] != 2 {
+		t.Fatalf("unexpected result %v with %d calls", got, calls[3])
+	}
+	var elementErr *ElementError
+	if !errors.As(s.Err(), &elementErr) || elementErr.Index != 2 || !errors.Is(s.Err(), errFlaky) {
+		t.Fatalf("unexpected error %v", s.Err())
+	}
+
+	calls = make(map[interface{}]int)
+	s = Of(1).MapWithRetry(failOn(map[interface{}]int{1: 1}, calls), RetryPolicy{
+		MaxAttempts: 3,
+		RetryIf: func(err error) bool {
+			return !errors.Is(err, errFlaky)
+		},
+	})
+	if s.Count(); calls[1] != 1 || s.Err() == nil {
+		t.Fatalf("expect error not retried, got %d calls", calls[1])
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+	expect := []time.Duration{10, 20, 40, 50, 50}
+	for idx, wait := range expect {
+		if got := backoff(idx + 1); got != wait*time.Millisecond {
+			t.Fatalf("retry %d: expect %v, got %v", idx+1, wait*time.Millisecond, got)
+		}
+	}
+}
+
+func TestExponentialBackoffSaturates(t *testing.T) {
+	backoff := ExponentialBackoff(time.Second, 0)
+	for _, retry := range []int{40, 64, 100, 1000} {
+		if got := backoff(retry); got != math.MaxInt64 {
+			t.Fatalf("retry %d: expect the longest Duration, got %v", retry, got)
+		}
+	}
+}
+
+// stuckClock is a fakeClock whose Sleep never returns until wake is closed
+type stuckClock struct {
+	*fakeClock
+	sleeping chan struct{}
+	wake     chan struct{}
+}
+
+func (c *stuckClock) Sleep(_ time.Duration) {
+	c.sleeping <- struct{}{}
+	<-c.wake
+}
+
+func TestMapWithRetryBackoffStopsOnCancel(t *testing.T) {
+	c := &stuckClock{fakeClock: newFakeClock(), sleeping: make(chan struct{}, 1), wake: make(chan struct{})}
+	defer close(c.wake)
+	calls := make(map[interface{}]int)
+	s := Of(1, 2).WithClock(c).MapWithRetry(failOn(map[interface{}]int{1: 5}, calls), RetryPolicy{
+		MaxAttempts: 5,
+		Backoff:     ExponentialBackoff(time.Hour, 0),
+	})
+	done := make(chan []interface{})
+	go func() {
+		done <- s.Collect()
+	}()
+	<-c.sleeping
+	s.(stage).getStartStage().cancel()
+	select {
+	case got := <-done:
+		if len(got) != 0 || calls[1] != 1 || calls[2] != 0 || !errors.Is(s.Err(), ErrCancelled) {
+			t.Fatalf("unexpected result %v with calls %v, error %v", got, calls, s.Err())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect backoff stopped by cancel")
+	}
+}
+
+func TestOnErrorReturn(t *testing.T) {
+	failing := func() Stream {
+		return Of(1, 2, 3, 4).MapWithRetry(failOn(map[interface{}]int{3: 1}, make(map[interface{}]int)), RetryPolicy{})
+	}
+	s := failing().OnErrorReturn(func(err error) interface{} {
+		return -1
+	})
+	if !strings.Contains(s.Explain(), "2. OnErrorReturn stateful") {
+		t.Fatalf("unexpected plan:\n%s", s.Explain())
+	}
+	if got := s.Collect(); !reflect.DeepEqual(got, []interface{}{1, 2, -1}) || s.Err() != nil {
+		t.Fatalf("unexpected result %v, error %v", got, s.Err())
+	}
+
+	s = failing().OnErrorResume(func(err error) Stream {
+		return Of(7, 8)
+	})
+	if got := s.Collect(); !reflect.DeepEqual(got, []interface{}{1, 2, 7, 8}) || s.Err() != nil {
+		t.Fatalf("unexpected result %v, error %v", got, s.Err())
+	}
+
+	s = failing().OnErrorResume(func(err error) Stream {
+		return failing()
+	})
+	if got := s.Collect(); !reflect.DeepEqual(got, []interface{}{1, 2, 1, 2}) || !errors.Is(s.Err(), errFlaky) {
+		t.Fatalf("expect error of fallback stream, got %v, error %v", got, s.Err())
+	}
+
+	s = Of(1, 2).OnErrorReturn(func(err error) interface{} {
+		return -1
+	})
+	if got := s.Collect(); !reflect.DeepEqual(got, []interface{}{1, 2}) {
+		t.Fatalf("expect data passed through without error, got %v", got)
+	}
+}
+
+func TestOnErrorIgnoresDownstreamErrors(t *testing.T) {
+	s := Of(1, 2, 3).OnErrorReturn(func(err error) interface{} {
+		return -1
+	}).MapWithRetry(failOn(map[interface{}]int{2: 1}, make(map[interface{}]int)), RetryPolicy{})
+	if got := s.Collect(); !reflect.DeepEqual(got, []interface{}{1}) || s.Err() == nil {
+		t.Fatalf("expect error after the handler kept, got %v, error %v", got, s.Err())
+	}
+}
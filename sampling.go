@@ -0,0 +1,174 @@
+package stream
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// defaultRand returns rng, or a new time seeded one if rng is nil
+func defaultRand(rng *rand.Rand) *rand.Rand {
+	if rng != nil {
+		return rng
+	}
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// reservoir keeps a uniform random sample of at most k elements out of seen elements
+type reservoir struct {
+	k    int
+	seen int64
+	data []interface{}
+	rng  *rand.Rand
+}
+
+func newReservoir(k int, rng *rand.Rand) *reservoir {
+	return &reservoir{k: k, data: make([]interface{}, 0, k), rng: rng}
+}
+
+func (r *reservoir) add(t interface{}) {
+	r.seen++
+	if len(r.data) < r.k {
+		r.data = append(r.data, t)
+		return
+	}
+	if idx := r.rng.Int63n(r.seen); idx < int64(r.k) {
+		r.data[idx] = t
+	}
+}
+
+// merge combines two reservoirs sampled from disjoint data into one which is
+// a uniform sample of the union, slots are drawn from either side in proportion
+// to the count of elements the side has seen
+func (r *reservoir) merge(other *reservoir) {
+	if other.seen == 0 {
+		return
+	}
+	if r.seen == 0 {
+		r.seen, r.data = other.seen, append(r.data[:0], other.data...)
+		return
+	}
+	left, right := append([]interface{}{}, r.data...), append([]interface{}{}, other.data...)
+	leftSeen, rightSeen := r.seen, other.seen
+	merged := make([]interface{}, 0, r.k)
+	for len(merged) < r.k && (len(left) > 0 || len(right) > 0) {
+		var from *[]interface{}
+		if len(right) == 0 || (len(left) > 0 && r.rng.Int63n(leftSeen+rightSeen) < leftSeen) {
+			from = &left
+			leftSeen--
+		} else {
+			from = &right
+			rightSeen--
+		}
+		idx := r.rng.Intn(len(*from))
+		merged = append(merged, (*from)[idx])
+		(*from)[idx] = (*from)[len(*from)-1]
+		*from = (*from)[:len(*from)-1]
+	}
+	r.seen += other.seen
+	r.data = merged
+}
+
+// sampleShard is the reservoir of one shard, elements are spread over shards in turn
+// and the reservoirs are merged at end
+type sampleShard struct {
+	l   sync.Mutex
+	res *reservoir
+}
+
+type sampleOp struct {
+	statefulOp
+	size   int
+	rng    *rand.Rand
+	shards []sampleShard
+	rr     roundRobin
+}
+
+func (s *sampleOp) begin(_ int) {
+	rng := defaultRand(s.rng)
+	s.shards = make([]sampleShard, s.shardCount())
+	for idx := range s.shards {
+		if len(s.shards) == 1 {
+			s.shards[idx].res = newReservoir(s.size, rng)
+		} else {
+			s.shards[idx].res = newReservoir(s.size, rand.New(rand.NewSource(rng.Int63())))
+		}
+	}
+}
+
+func (s *sampleOp) accept(t interface{}) {
+	shard := &s.shards[s.rr.next(len(s.shards))]
+	shard.l.Lock()
+	shard.res.add(t)
+	shard.l.Unlock()
+}
+
+func (s *sampleOp) end() {
+	res := s.shards[0].res
+	for idx := 1; idx < len(s.shards); idx++ {
+		res.merge(s.shards[idx].res)
+	}
+	s.shards = nil
+	s.downStream.begin(len(res.data))
+	for idx := range res.data {
+		if s.stopRequested() {
+			break
+		}
+		s.downStream.accept(res.data[idx])
+	}
+	s.downStream.end()
+}
+
+type sampleFractionOp struct {
+	statefulOp
+	fraction float64
+	rng      *rand.Rand
+}
+
+func (s *sampleFractionOp) begin(size int) {
+	s.rng = defaultRand(s.rng)
+	s.downStream.begin(int(float64(size) * s.fraction))
+}
+
+func (s *sampleFractionOp) accept(t interface{}) {
+	s.l.Lock()
+	pick := s.rng.Float64() < s.fraction
+	s.l.Unlock()
+	if pick && !s.stopRequested() {
+		s.downStream.accept(t)
+	}
+}
+
+type shuffleOp struct {
+	statefulOp
+	rng  *rand.Rand
+	data []interface{}
+}
+
+func (s *shuffleOp) begin(size int) {
+	if size > 0 {
+		s.data = make([]interface{}, 0, size)
+	} else {
+		s.data = make([]interface{}, 0)
+	}
+}
+
+func (s *shuffleOp) accept(t interface{}) {
+	s.l.Lock()
+	s.data = append(s.data, t)
+	s.l.Unlock()
+}
+
+func (s *shuffleOp) end() {
+	defaultRand(s.rng).Shuffle(len(s.data), func(i, j int) {
+		s.data[i], s.data[j] = s.data[j], s.data[i]
+	})
+	s.downStream.begin(len(s.data))
+	for idx := range s.data {
+		if s.stopRequested() {
+			break
+		}
+		s.downStream.accept(s.data[idx])
+	}
+	s.downStream.end()
+}
@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestSampleIsReproducible(t *testing.T) {
+	given := dataGenerator()
+	first := New(given).Sample(10, rand.New(rand.NewSource(42))).Collect()
+	second := New(given).Sample(10, rand.New(rand.NewSource(42))).Collect()
+	if len(first) != 10 {
+		t.Fatalf("expect 10 elements, got %d", len(first))
+	}
+	for idx := range first {
+		if first[idx] != second[idx] {
+			t.Fatalf("samples with same seed differ: %v %v", first, second)
+		}
+	}
+	if got := Of(1, 2).Sample(10, nil).Count(); got != 2 {
+		t.Fatalf("expect 2 elements, got %d", got)
+	}
+}
+
+func TestParallelSample(t *testing.T) {
+	var l sync.Mutex
+	seen := make(map[interface{}]bool)
+	New(dataGenerator()).Parallel().Sample(10, rand.New(rand.NewSource(42))).ForEach(func(v interface{}) {
+		l.Lock()
+		seen[v] = true
+		l.Unlock()
+	})
+	if len(seen) != 10 {
+		t.Fatalf("expect 10 different elements, got %v", seen)
+	}
+}
+
+func TestSampleFraction(t *testing.T) {
+	first := New(dataGenerator()).SampleFraction(0.3, rand.New(rand.NewSource(3))).Collect()
+	second := New(dataGenerator()).SampleFraction(0.3, rand.New(rand.NewSource(3))).Collect()
+	if len(first) < 40 || len(first) > 80 {
+		t.Fatalf("expect about 60 elements, got %d", len(first))
+	}
+	if len(first) != len(second) {
+		t.Fatalf("samples with same seed differ: %v %v", first, second)
+	}
+	for idx := range first {
+		if first[idx] != second[idx] {
+			t.Fatalf("samples with same seed differ: %v %v", first, second)
+		}
+	}
+	if got := Of(1, 2, 3).SampleFraction(0, nil).Count(); got != 0 {
+		t.Fatalf("expect no element, got %d", got)
+	}
+}
+
+func TestReservoirMerge(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	fromLeft := 0
+	for round := 0; round < 1000; round++ {
+		left, right := newReservoir(4, rng), newReservoir(4, rng)
+		for i := 0; i < 300; i++ {
+			left.add(0)
+		}
+		for i := 0; i < 100; i++ {
+			right.add(1)
+		}
+		left.merge(right)
+		if left.seen != 400 || len(left.data) != 4 {
+			t.Fatalf("unexpected merged reservoir seen %d size %d", left.seen, len(left.data))
+		}
+		for _, v := range left.data {
+			if v == 0 {
+				fromLeft++
+			}
+		}
+	}
+	// three quarters of the merged sample should come from the left side
+	if ratio := float64(fromLeft) / 4000; ratio < 0.72 || ratio > 0.78 {
+		t.Fatalf("unexpected ratio of left elements %f", ratio)
+	}
+}
+
+func TestShuffleIsReproducible(t *testing.T) {
+	first := New(dataGenerator()).Shuffle(rand.New(rand.NewSource(7))).Collect()
+	second := New(dataGenerator()).Shuffle(rand.New(rand.NewSource(7))).Collect()
+	if len(first) != 200 {
+		t.Fatalf("expect 200 elements, got %d", len(first))
+	}
+	for idx := range first {
+		if first[idx] != second[idx] {
+			t.Fatal("shuffles with same seed differ")
+		}
+	}
+}
+
+func TestSampleRejectsInvalidArguments(t *testing.T) {
+	cases := map[string]func(){
+		"negative k":        func() { Of(1, 2).Sample(-1, nil) },
+		"negative fraction": func() { Of(1, 2).SampleFraction(-0.1, nil) },
+		"fraction above 1":  func() { Of(1, 2).SampleFraction(1.5, nil) },
+		"NaN fraction":      func() { Of(1, 2).SampleFraction(math.NaN(), nil) },
+	}
+	for name, build := range cases {
+		func() {
+			defer func() {
+				if p := recover(); p == nil {
+					t.Errorf("%s: expect panic when the stage is built", name)
+				}
+			}()
+			build()
+		}()
+	}
+	if got := Of(1, 2).Sample(0, nil).Count(); got != 0 {
+		t.Fatalf("expect nothing sampled for k 0, got %d", got)
+	}
+}
@@ -1,6 +1,14 @@
 package stream
 
-import "fmt"
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
 
 type streamer int
 
@@ -23,8 +31,41 @@ const (
 	opLast
 	opFuncDistincter
 	opReduce
+	opExternalSorter
+	opJoiner
+	opCoGrouper
+	opSampler
+	opFractionSampler
+	opShuffler
+	opApproxDistinctCounter
+	opApproxQuantiler
+	opApproxTopFrequenter
+	opCSVWriter
+	opJSONLinesWriter
+	opMapCollector
+	opSQLBatchWriter
+	opChannelSender
+	opTee
+	opOperator
+	opInto
+	opRateLimiter
+	opThrottler
+	opDebouncer
+	opDelayer
+	opTumblingWindower
+	opSlidingWindower
+	opSessionWindower
+	opAsyncMapper
+	opOrderedAsyncMapper
+	opRetryMapper
+	opErrorReturner
+	opErrorResumer
+	opPartitioner
 )
 
+// topFrequentFactor is the count of counters ApproxTopFrequent tracks for each wanted element
+const topFrequentFactor = 10
+
 // wrapSink is a helper function takes care of creating different kind of stages
 func wrapSink(b *baseStage, s streamer, callback ...interface{}) stage {
 	var nextStage stage
@@ -112,14 +153,258 @@ func wrapSink(b *baseStage, s streamer, callback ...interface{}) stage {
 		downStream.reduceFunc = callback[0].(ReduceFunc)
 		downStream.out = callback[1]
 		nextStage = downStream
+	case opExternalSorter:
+		downStream := new(externalSorterOp)
+		if len(callback) != 2 {
+			panic(fmt.Sprintf("opExternalSorter needs 2 callbacks"))
+		}
+		checkCallback("sortWith", callback)
+		downStream.comparator = callback[0].(ComparatorFunc)
+		downStream.opts = callback[1].(SortOptions)
+		nextStage = downStream
+	case opJoiner:
+		downStream := new(joinOp)
+		if len(callback) != 5 {
+			panic(fmt.Sprintf("opJoiner needs 5 callbacks"))
+		}
+		downStream.kind = callback[0].(joinKind)
+		downStream.other = callback[1].(Stream)
+		downStream.leftKey = callback[2].(KeyFunc)
+		downStream.rightKey = callback[3].(KeyFunc)
+		downStream.combine = callback[4].(JoinFunc)
+		nextStage = downStream
+	case opCoGrouper:
+		downStream := new(coGroupOp)
+		if len(callback) != 3 {
+			panic(fmt.Sprintf("opCoGrouper needs 3 callbacks"))
+		}
+		downStream.other = callback[0].(Stream)
+		downStream.leftKey = callback[1].(KeyFunc)
+		downStream.rightKey = callback[2].(KeyFunc)
+		nextStage = downStream
+	case opSampler:
+		downStream := new(sampleOp)
+		if len(callback) != 2 {
+			panic(fmt.Sprintf("opSampler needs 2 callbacks"))
+		}
+		downStream.size = callback[0].(int)
+		downStream.rng = callback[1].(*rand.Rand)
+		if downStream.size < 0 {
+			panic("k of Sample should not be negative")
+		}
+		nextStage = downStream
+	case opFractionSampler:
+		downStream := new(sampleFractionOp)
+		if len(callback) != 2 {
+			panic(fmt.Sprintf("opFractionSampler needs 2 callbacks"))
+		}
+		downStream.fraction = callback[0].(float64)
+		downStream.rng = callback[1].(*rand.Rand)
+		if !(downStream.fraction >= 0 && downStream.fraction <= 1) {
+			panic("fraction of SampleFraction should be in [0, 1]")
+		}
+		nextStage = downStream
+	case opShuffler:
+		downStream := new(shuffleOp)
+		checkCallback("shuffle", callback)
+		downStream.rng = callback[0].(*rand.Rand)
+		nextStage = downStream
+	case opApproxDistinctCounter:
+		downStream := new(approxDistinctOp)
+		checkCallback("approxCountDistinct", callback)
+		downStream.precision = callback[0].(int)
+		newHyperLogLog(downStream.precision) // check precision before the stream runs
+		nextStage = downStream
+	case opApproxQuantiler:
+		downStream := new(approxQuantilesOp)
+		nextStage = downStream
+	case opApproxTopFrequenter:
+		downStream := new(approxTopFrequentOp)
+		checkCallback("approxTopFrequent", callback)
+		if callback[0].(int) <= 0 {
+			panic("k of ApproxTopFrequent should be positive")
+		}
+		downStream.capacity = callback[0].(int) * topFrequentFactor
+		nextStage = downStream
+	case opCSVWriter:
+		downStream := new(csvWriterOp)
+		if len(callback) != 2 {
+			panic(fmt.Sprintf("opCSVWriter needs 2 callbacks"))
+		}
+		downStream.writer = csv.NewWriter(callback[0].(io.Writer))
+		downStream.opts = callback[1].(CSVOptions)
+		nextStage = downStream
+	case opJSONLinesWriter:
+		downStream := new(jsonLinesWriterOp)
+		checkCallback("toJSONLines", callback)
+		downStream.writer = bufio.NewWriter(callback[0].(io.Writer))
+		nextStage = downStream
+	case opMapCollector:
+		downStream := new(toMapOp)
+		if len(callback) != 2 {
+			panic(fmt.Sprintf("opMapCollector needs 2 callbacks"))
+		}
+		downStream.out = callback[0]
+		downStream.policy = callback[1].(DuplicatePolicy)
+		nextStage = downStream
+	case opSQLBatchWriter:
+		downStream := new(sqlBatchOp)
+		if len(callback) != 3 {
+			panic(fmt.Sprintf("opSQLBatchWriter needs 3 callbacks"))
+		}
+		downStream.db = callback[0].(*sql.DB)
+		downStream.batchSize = callback[1].(int)
+		downStream.exec = callback[2].(BatchFunc)
+		if downStream.batchSize <= 0 {
+			panic("batch size of ToSQLBatches should be positive")
+		}
+		nextStage = downStream
+	case opChannelSender:
+		downStream := new(channelOp)
+		if len(callback) != 2 {
+			panic(fmt.Sprintf("opChannelSender needs 2 callbacks"))
+		}
+		downStream.ch = callback[0].(chan interface{})
+		downStream.cancelled = callback[1].(chan struct{})
+		nextStage = downStream
+	case opTee:
+		downStream := new(teeOp)
+		checkCallback("tee", callback)
+		downStream.init(callback[0].(int))
+		nextStage = downStream
+	case opOperator:
+		downStream := new(operatorOp)
+		checkCallback("via", callback)
+		downStream.op = callback[0].(Operator)
+		nextStage = downStream
+	case opInto:
+		downStream := new(intoOp)
+		checkCallback("into", callback)
+		downStream.user = callback[0].(Sink)
+		nextStage = downStream
+	case opRateLimiter:
+		downStream := new(rateLimitOp)
+		if len(callback) != 2 {
+			panic(fmt.Sprintf("opRateLimiter needs 2 callbacks"))
+		}
+		downStream.n = callback[0].(int)
+		downStream.per = callback[1].(time.Duration)
+		if downStream.n <= 0 || downStream.per <= 0 {
+			panic("rate limit should be positive")
+		}
+		nextStage = downStream
+	case opThrottler:
+		downStream := new(throttleOp)
+		checkCallback("throttle", callback)
+		downStream.interval = callback[0].(time.Duration)
+		if downStream.interval <= 0 {
+			panic("Throttle interval should be positive")
+		}
+		nextStage = downStream
+	case opDebouncer:
+		downStream := new(debounceOp)
+		checkCallback("debounce", callback)
+		downStream.quiet = callback[0].(time.Duration)
+		if downStream.quiet <= 0 {
+			panic("Debounce quiet duration should be positive")
+		}
+		nextStage = downStream
+	case opDelayer:
+		downStream := new(delayOp)
+		checkCallback("delay", callback)
+		downStream.delay = callback[0].(time.Duration)
+		if downStream.delay <= 0 {
+			panic("Delay should be positive")
+		}
+		nextStage = downStream
+	case opTumblingWindower, opSlidingWindower, opSessionWindower:
+		downStream := new(windowOp)
+		if len(callback) != 3 {
+			panic(fmt.Sprintf("window needs 3 callbacks"))
+		}
+		downStream.size = callback[0].(time.Duration)
+		downStream.slide = callback[1].(time.Duration)
+		downStream.opts = callback[2].(WindowOptions)
+		if s == opSessionWindower {
+			downStream.kind = sessionWindow
+		}
+		if downStream.size <= 0 || downStream.slide <= 0 {
+			panic("window size should be positive")
+		}
+		nextStage = downStream
+	case opAsyncMapper, opOrderedAsyncMapper:
+		downStream := new(mapAsyncOp)
+		if len(callback) != 2 {
+			panic(fmt.Sprintf("opAsyncMapper needs 2 callbacks"))
+		}
+		downStream.concurrency = callback[0].(int)
+		downStream.fn = callback[1].(AsyncMapFunc)
+		downStream.ordered = s == opOrderedAsyncMapper
+		if downStream.concurrency <= 0 {
+			panic("concurrency should be positive")
+		}
+		nextStage = downStream
+	case opRetryMapper:
+		downStream := new(mapRetryOp)
+		if len(callback) != 2 {
+			panic(fmt.Sprintf("opRetryMapper needs 2 callbacks"))
+		}
+		checkCallback("mapWithRetry", callback)
+		downStream.fn = callback[0].(AsyncMapFunc)
+		downStream.policy = callback[1].(RetryPolicy)
+		nextStage = downStream
+	case opErrorReturner:
+		downStream := new(onErrorOp)
+		checkCallback("onErrorReturn", callback)
+		downStream.returnFn = callback[0].(ErrorReturnFunc)
+		nextStage = downStream
+	case opErrorResumer:
+		downStream := new(onErrorOp)
+		checkCallback("onErrorResume", callback)
+		downStream.resumeFn = callback[0].(ErrorResumeFunc)
+		nextStage = downStream
+	case opPartitioner:
+		downStream := new(partitionStage)
+		if len(callback) != 2 {
+			panic(fmt.Sprintf("opPartitioner needs 2 callbacks"))
+		}
+		checkCallback("partitionBy", callback)
+		downStream.keyFunc = callback[0].(KeyFunc)
+		workers := callback[1].(int)
+		if workers <= 0 {
+			panic("workers should be positive")
+		}
+		downStream.workers = make([]chan interface{}, workers)
+		nextStage = downStream
+		b.paralleled = true
 	default:
 		panic(fmt.Sprintf("unknown op %v", s))
 	}
+	node := newPlanNode(s, b.getNode(), callback)
+	skipUnnecessary(s, node)
+	if d, ok := nextStage.(interface{ describe(node *planNode) }); ok {
+		d.describe(node) // stages with dynamic description
+	}
+	nextStage.setNode(node)
+	nextStage.setSelf(nextStage)
 	b.setNextSink(nextStage)
 	nextStage.setStartStage(b.getStartStage())
 	return nextStage
 }
 
+// skipUnnecessary marks the stages whose work makes no difference to the result,
+// a Distinct on DISTINCT data. A sort directly followed by another one is skipped
+// when the stream runs by skipSupersededSorts
+func skipUnnecessary(s streamer, node *planNode) {
+	switch s {
+	case opDistincter:
+		if node.input&Distinct != 0 {
+			node.skipped = true
+			node.characteristics = node.input
+		}
+	}
+}
+
 func checkCallback(name string, callback ...interface{}) {
 	if len(callback) == 0 {
 		panic(fmt.Sprintf("not callback function found for %s", name))
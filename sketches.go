@@ -0,0 +1,379 @@
+package stream
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// hashValue hashes an element into 64 bits, golang built in types are hashed by
+// their binary form and other types by their printed form. Values equal to each other
+// have the same hash, such as 0 and -0, which PartitionBy relies on
+func hashValue(v interface{}) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	switch val := v.(type) {
+	case string:
+		h.Write([]byte(val))
+	case []byte:
+		h.Write(val)
+	case int:
+		binary.LittleEndian.PutUint64(buf[:], uint64(val))
+		h.Write(buf[:])
+	case int64:
+		binary.LittleEndian.PutUint64(buf[:], uint64(val))
+		h.Write(buf[:])
+	case int32:
+		binary.LittleEndian.PutUint64(buf[:], uint64(val))
+		h.Write(buf[:])
+	case uint:
+		binary.LittleEndian.PutUint64(buf[:], uint64(val))
+		h.Write(buf[:])
+	case uint64:
+		binary.LittleEndian.PutUint64(buf[:], val)
+		h.Write(buf[:])
+	case uint32:
+		binary.LittleEndian.PutUint64(buf[:], uint64(val))
+		h.Write(buf[:])
+	case float64:
+		if val == 0 {
+			val = 0 // -0 equals 0 but has other bits
+		}
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(val))
+		h.Write(buf[:])
+	case float32:
+		if val == 0 {
+			val = 0
+		}
+		binary.LittleEndian.PutUint64(buf[:], uint64(math.Float32bits(val)))
+		h.Write(buf[:])
+	default:
+		fmt.Fprintf(h, "%T:%v", v, v)
+	}
+	return mix64(h.Sum64())
+}
+
+// mix64 is the finalizer of splitmix64, it spreads entropy of fnv to all bits
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// hyperLogLog estimates the count of distinct elements with 2^precision registers
+type hyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+func newHyperLogLog(precision int) *hyperLogLog {
+	if precision < 4 || precision > 18 {
+		panic(fmt.Sprintf("precision %d is out of range [4, 18]", precision))
+	}
+	return &hyperLogLog{precision: uint8(precision), registers: make([]uint8, 1<<uint(precision))}
+}
+
+func (h *hyperLogLog) add(v interface{}) {
+	hash := hashValue(v)
+	idx := hash >> (64 - h.precision)
+	rank := uint8(bits.LeadingZeros64(hash<<h.precision|1<<(h.precision-1))) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for idx := range h.registers {
+		if other.registers[idx] > h.registers[idx] {
+			h.registers[idx] = other.registers[idx]
+		}
+	}
+}
+
+func (h *hyperLogLog) estimate() int {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	var alpha float64
+	switch len(h.registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 { // small range correction
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(estimate + 0.5)
+}
+
+const kllDefaultK = 200
+
+// kllSketch approximates quantiles of numbers, it keeps a hierarchy of compactors,
+// an item of level h stands for 2^h original items
+type kllSketch struct {
+	k      int
+	levels [][]float64
+	count  int64
+	flip   bool // alternates the offset of compaction
+}
+
+func newKLLSketch(k int) *kllSketch {
+	return &kllSketch{k: k, levels: make([][]float64, 1)}
+}
+
+// capacity returns the max size of level h, lower levels get smaller capacity
+func (s *kllSketch) capacity(h int) int {
+	depth := len(s.levels) - h - 1
+	c := int(math.Ceil(float64(s.k) * math.Pow(2.0/3.0, float64(depth))))
+	if c < 2 {
+		return 2
+	}
+	return c
+}
+
+func (s *kllSketch) size() int {
+	size := 0
+	for _, level := range s.levels {
+		size += len(level)
+	}
+	return size
+}
+
+func (s *kllSketch) maxSize() int {
+	size := 0
+	for h := range s.levels {
+		size += s.capacity(h)
+	}
+	return size
+}
+
+func (s *kllSketch) add(v float64) {
+	s.levels[0] = append(s.levels[0], v)
+	s.count++
+	s.compress()
+}
+
+func (s *kllSketch) compress() {
+	for s.size() > s.maxSize() {
+		for h := range s.levels {
+			if len(s.levels[h]) < s.capacity(h) {
+				continue
+			}
+			if h+1 == len(s.levels) {
+				s.levels = append(s.levels, nil)
+			}
+			level := s.levels[h]
+			sort.Float64s(level)
+			offset := 0
+			if s.flip {
+				offset = 1
+			}
+			s.flip = !s.flip
+			for idx := offset; idx < len(level); idx += 2 {
+				s.levels[h+1] = append(s.levels[h+1], level[idx])
+			}
+			s.levels[h] = level[:0]
+			break
+		}
+	}
+}
+
+func (s *kllSketch) merge(other *kllSketch) {
+	for len(s.levels) < len(other.levels) {
+		s.levels = append(s.levels, nil)
+	}
+	for h := range other.levels {
+		s.levels[h] = append(s.levels[h], other.levels[h]...)
+	}
+	s.count += other.count
+	s.compress()
+}
+
+// quantiles returns the approximate value of each quantile in qs,
+// NaN is returned for every quantile if sketch is empty
+func (s *kllSketch) quantiles(qs []float64) []float64 {
+	type weighted struct {
+		val    float64
+		weight int64
+	}
+	items := make([]weighted, 0, s.size())
+	var total int64
+	for h, level := range s.levels {
+		for _, v := range level {
+			items = append(items, weighted{v, 1 << uint(h)})
+			total += 1 << uint(h)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].val < items[j].val
+	})
+	res := make([]float64, len(qs))
+	for idx, q := range qs {
+		if len(items) == 0 {
+			res[idx] = math.NaN()
+			continue
+		}
+		rank := int64(math.Ceil(q * float64(total)))
+		var cumulative int64
+		res[idx] = items[len(items)-1].val
+		for _, item := range items {
+			cumulative += item.weight
+			if cumulative >= rank {
+				res[idx] = item.val
+				break
+			}
+		}
+	}
+	return res
+}
+
+// FrequentItem is an element reported by ApproxTopFrequent, Count is an over estimation
+// of the occurrence of Value and Count - Error is guaranteed to be no more than the real one
+type FrequentItem struct {
+	Value interface{}
+	Count int64
+	Error int64
+}
+
+// spaceSaving tracks the most frequent elements with a fixed count of counters
+type spaceSaving struct {
+	capacity int
+	counters counterHeap
+	index    map[interface{}]*counter
+}
+
+// counter is a FrequentItem tracked by spaceSaving, pos is its index in counterHeap
+type counter struct {
+	FrequentItem
+	pos int
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{capacity: capacity, index: make(map[interface{}]*counter)}
+}
+
+func (s *spaceSaving) add(v interface{}) {
+	if c, ok := s.index[v]; ok {
+		c.Count++
+		heap.Fix(&s.counters, c.pos)
+		return
+	}
+	if len(s.counters) < s.capacity {
+		c := &counter{FrequentItem: FrequentItem{Value: v, Count: 1}}
+		s.index[v] = c
+		heap.Push(&s.counters, c)
+		return
+	}
+	// replace the least frequent one
+	min := s.counters[0]
+	delete(s.index, min.Value)
+	s.index[v] = min
+	min.Value = v
+	min.Error = min.Count
+	min.Count++
+	heap.Fix(&s.counters, 0)
+}
+
+// minCount is the count of any element not tracked could have at most
+func (s *spaceSaving) minCount() int64 {
+	if len(s.counters) < s.capacity {
+		return 0
+	}
+	return s.counters[0].Count
+}
+
+func (s *spaceSaving) merge(other *spaceSaving) {
+	merged := make(map[interface{}]*counter, len(s.index)+len(other.index))
+	selfMin, otherMin := s.minCount(), other.minCount()
+	for key, c := range s.index {
+		merged[key] = &counter{FrequentItem: FrequentItem{Value: key, Count: c.Count + otherMin, Error: c.Error + otherMin}}
+	}
+	for key, c := range other.index {
+		if m, ok := merged[key]; ok {
+			m.Count += c.Count - otherMin
+			m.Error += c.Error - otherMin
+		} else {
+			merged[key] = &counter{FrequentItem: FrequentItem{Value: key, Count: c.Count + selfMin, Error: c.Error + selfMin}}
+		}
+	}
+	counters := make(counterHeap, 0, len(merged))
+	for _, c := range merged {
+		counters = append(counters, c)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		return counters[i].Count > counters[j].Count
+	})
+	if len(counters) > s.capacity {
+		counters = counters[:s.capacity]
+	}
+	s.index = make(map[interface{}]*counter, len(counters))
+	for idx, c := range counters {
+		c.pos = idx
+		s.index[c.Value] = c
+	}
+	s.counters = counters
+	heap.Init(&s.counters)
+}
+
+// top returns at most k most frequent elements, ordered by Count descending
+func (s *spaceSaving) top(k int) []FrequentItem {
+	items := make([]FrequentItem, 0, len(s.counters))
+	for _, c := range s.counters {
+		items = append(items, c.FrequentItem)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Count > items[j].Count
+	})
+	if len(items) > k {
+		items = items[:k]
+	}
+	return items
+}
+
+// counterHeap is a min heap of counters ordered by Count
+type counterHeap []*counter
+
+func (c counterHeap) Len() int {
+	return len(c)
+}
+
+func (c counterHeap) Less(i, j int) bool {
+	return c[i].Count < c[j].Count
+}
+
+func (c counterHeap) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+	c[i].pos = i
+	c[j].pos = j
+}
+
+func (c *counterHeap) Push(x interface{}) {
+	item := x.(*counter)
+	item.pos = len(*c)
+	*c = append(*c, item)
+}
+
+func (c *counterHeap) Pop() interface{} {
+	old := *c
+	last := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return last
+}
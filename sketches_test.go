@@ -0,0 +1,114 @@
+package stream
+
+import (
+	"math"
+	"testing"
+)
+
+func TestApproxCountDistinct(t *testing.T) {
+	data := make([]int, 0, 200000)
+	for i := 0; i < 200000; i++ {
+		data = append(data, i%50000)
+	}
+	got := New(data).ApproxCountDistinct(14)
+	if math.Abs(float64(got)-50000)/50000 > 0.03 {
+		t.Fatalf("estimation %d is too far from 50000", got)
+	}
+
+	left, right := newHyperLogLog(12), newHyperLogLog(12)
+	for i := 0; i < 10000; i++ {
+		left.add(i)
+		right.add(i + 5000)
+	}
+	left.merge(right)
+	if est := left.estimate(); math.Abs(float64(est)-15000)/15000 > 0.05 {
+		t.Fatalf("merged estimation %d is too far from 15000", est)
+	}
+}
+
+func TestApproxQuantiles(t *testing.T) {
+	data := make([]int, 0, 100000)
+	for i := 1; i <= 100000; i++ {
+		data = append(data, i)
+	}
+	got := New(data).ApproxQuantiles(0, 0.5, 0.99, 1)
+	expect := []float64{1, 50000, 99000, 100000}
+	for idx := range expect {
+		if math.Abs(got[idx]-expect[idx]) > 2000 {
+			t.Fatalf("quantiles %v too far from %v", got, expect)
+		}
+	}
+
+	left, right := newKLLSketch(kllDefaultK), newKLLSketch(kllDefaultK)
+	for i := 0; i < 50000; i++ {
+		left.add(float64(i))
+		right.add(float64(i + 50000))
+	}
+	left.merge(right)
+	if median := left.quantiles([]float64{0.5})[0]; math.Abs(median-50000) > 2000 {
+		t.Fatalf("merged median %f too far from 50000", median)
+	}
+
+	s := Of("a")
+	s.ApproxQuantiles(0.5)
+	if s.Err() == nil {
+		t.Fatal("expect error for non numeric element")
+	}
+}
+
+func TestApproxTopFrequent(t *testing.T) {
+	data := make([]int, 0)
+	for i := 0; i < 10000; i++ {
+		data = append(data, i)
+		if i%10 == 0 {
+			data = append(data, -1, -1, -2)
+		}
+	}
+	got := New(data).ApproxTopFrequent(2)
+	if len(got) != 2 || got[0].Value != -1 || got[1].Value != -2 {
+		t.Fatalf("unexpected top frequent %v", got)
+	}
+	if got[0].Count-got[0].Error > 2000 || got[0].Count < 2000 {
+		t.Fatalf("count of -1 should be bounded around 2000, got %+v", got[0])
+	}
+
+	left, right := newSpaceSaving(4), newSpaceSaving(4)
+	for i := 0; i < 100; i++ {
+		left.add("x")
+		right.add("x")
+		right.add(i)
+	}
+	left.merge(right)
+	if top := left.top(1); top[0].Value != "x" || top[0].Count < 200 {
+		t.Fatalf("unexpected merged top %v", top)
+	}
+}
+
+func TestParallelSketches(t *testing.T) {
+	withShards(t, 4)
+	data := make([]int, 0, 100000)
+	for i := 1; i <= 100000; i++ {
+		data = append(data, i)
+	}
+	if got := New(data).Parallel().ApproxCountDistinct(14); math.Abs(float64(got)-100000)/100000 > 0.03 {
+		t.Fatalf("estimation %d is too far from 100000", got)
+	}
+	if got := New(data).Parallel().ApproxQuantiles(0.5)[0]; math.Abs(got-50000) > 2000 {
+		t.Fatalf("median %f too far from 50000", got)
+	}
+	for i := 0; i < 1000; i++ {
+		data = append(data, -1)
+	}
+	if got := New(data).Parallel().ApproxTopFrequent(1); len(got) != 1 || got[0].Value != -1 || got[0].Count < 1000 {
+		t.Fatalf("unexpected top frequent %v", got)
+	}
+}
+
+func TestApproxTopFrequentRejectsNonPositiveK(t *testing.T) {
+	defer func() {
+		if p := recover(); p == nil {
+			t.Fatal("expect panic for k 0")
+		}
+	}()
+	Of(1, 2).ApproxTopFrequent(0)
+}
@@ -0,0 +1,94 @@
+package stream
+
+import (
+	"bufio"
+	"io"
+)
+
+// source provides data to the beginning of a stream, data is read lazily
+// so that reading stops as soon as downstream requests cancellation
+type source interface {
+	// size returns the count of elements, non-positive value means unknown
+	size() int
+	// next returns the next element, ok is false when source is exhausted or failed
+	next() (v interface{}, ok bool)
+	// err returns the error which stopped the source
+	err() error
+	// close releases resources held by source, it is called once the stream is done
+	close()
+}
+
+type sliceSource struct {
+	data  []interface{}
+	pos   int
+	extra Characteristics // characteristics known by the creator of source
+}
+
+func (s *sliceSource) size() int {
+	return len(s.data)
+}
+
+func (s *sliceSource) characteristics() Characteristics {
+	c := Sized | Ordered | s.extra
+	for idx := range s.data {
+		if s.data[idx] == nil {
+			return c &^ NonNull
+		}
+	}
+	return c | NonNull
+}
+
+func (s *sliceSource) next() (interface{}, bool) {
+	if s.pos >= len(s.data) {
+		return nil, false
+	}
+	s.pos++
+	return s.data[s.pos-1], true
+}
+
+func (s *sliceSource) err() error {
+	return nil
+}
+
+func (s *sliceSource) close() {}
+
+type scannerSource struct {
+	scanner *bufio.Scanner
+}
+
+func (s *scannerSource) size() int {
+	return 0
+}
+
+func (s *scannerSource) characteristics() Characteristics {
+	return Ordered | NonNull
+}
+
+func (s *scannerSource) next() (interface{}, bool) {
+	if !s.scanner.Scan() {
+		return nil, false
+	}
+	return s.scanner.Text(), true
+}
+
+func (s *scannerSource) err() error {
+	return s.scanner.Err()
+}
+
+func (s *scannerSource) close() {}
+
+// FromLines creates a Stream of lines read lazily from r, line endings are stripped.
+// Errors occurred while reading are reported by Stream.Err
+func FromLines(r io.Reader) Stream {
+	return FromScanner(bufio.NewScanner(r), bufio.ScanLines)
+}
+
+// FromScanner creates a Stream of tokens produced by scanner, the split function
+// of scanner is replaced if split is not nil. Errors occurred while scanning are
+// reported by Stream.Err
+func FromScanner(scanner *bufio.Scanner, split bufio.SplitFunc) Stream {
+	if split != nil {
+		scanner.Split(split)
+	}
+	return newStream(&scannerSource{scanner: scanner})
+}
@@ -0,0 +1,58 @@
+package stream
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p[:1])
+	c.read += n
+	return n, err
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(_ []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestFromLines(t *testing.T) {
+	s := FromLines(strings.NewReader("a\nbb\n\nccc\n"))
+	got := s.Filter(func(v interface{}) bool {
+		return v.(string) != ""
+	}).Collect()
+	if len(got) != 3 || got[2] != "ccc" || s.Err() != nil {
+		t.Fatalf("unexpected lines %v, err %v", got, s.Err())
+	}
+
+	r := &countingReader{r: strings.NewReader("1\n2\n3\n4\n5\n")}
+	if got := FromLines(r).Limit(2).Collect(); len(got) != 2 {
+		t.Fatalf("unexpected lines %v", got)
+	}
+	if r.read >= 10 {
+		t.Fatalf("reader should stop after limit, %d bytes read", r.read)
+	}
+
+	s = FromLines(failingReader{})
+	s.Count()
+	if s.Err() == nil {
+		t.Fatal("expect read error reported")
+	}
+}
+
+func TestFromScanner(t *testing.T) {
+	got := FromScanner(bufio.NewScanner(strings.NewReader("a b  c")), bufio.ScanWords).Count()
+	if got != 3 {
+		t.Fatalf("expect 3 words, got %d", got)
+	}
+}
@@ -0,0 +1,149 @@
+package stream
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ScanFunc scans the current row of rows into an element
+type ScanFunc func(rows *sql.Rows) (interface{}, error)
+
+// BatchFunc writes a batch of elements within tx, batch is not reused after it returns
+type BatchFunc func(tx *sql.Tx, batch []interface{}) error
+
+const dbTag = "db"
+
+// ScanStruct returns a ScanFunc which scans each row into a new value of the prototype
+// type, columns are mapped to fields by the db tag or the field name case insensitively,
+// columns without field are discarded. A pointer is emitted if prototype is a pointer
+func ScanStruct(prototype interface{}) ScanFunc {
+	typ, ok := structType(prototype)
+	if !ok {
+		panic(fmt.Sprintf("scan prototype %T is not a struct", prototype))
+	}
+	fields := structFields(typ, dbTag)
+	returnPtr := reflect.TypeOf(prototype).Kind() == reflect.Ptr
+	return func(rows *sql.Rows) (interface{}, error) {
+		columns, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		ptr := reflect.New(typ)
+		dest := make([]interface{}, len(columns))
+		for col, name := range columns {
+			dest[col] = new(interface{})
+			for idx := range fields {
+				if strings.EqualFold(name, fields[idx].name) {
+					dest[col] = ptr.Elem().FieldByIndex(fields[idx].index).Addr().Interface()
+					break
+				}
+			}
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if returnPtr {
+			return ptr.Interface(), nil
+		}
+		return ptr.Elem().Interface(), nil
+	}
+}
+
+type rowsSource struct {
+	rows  *sql.Rows
+	scan  ScanFunc
+	index int // count of rows scanned
+}
+
+func (r *rowsSource) size() int {
+	return 0
+}
+
+func (r *rowsSource) next() (interface{}, bool) {
+	if !r.rows.Next() {
+		return nil, false
+	}
+	r.index++
+	v, err := r.scan(r.rows)
+	if err != nil {
+		return badElement{&ElementError{Index: r.index - 1, Err: err}}, true
+	}
+	return v, true
+}
+
+func (r *rowsSource) err() error {
+	return r.rows.Err()
+}
+
+func (r *rowsSource) close() {
+	r.rows.Close()
+}
+
+// FromRows creates a Stream of elements scanned from rows use scan, rows is closed
+// once the stream completes or is cancelled. Errors occurred while iterating are reported
+// by Stream.Err, a row could not be scanned is handled by the ErrorStrategy of stream
+func FromRows(rows *sql.Rows, scan ScanFunc) Stream {
+	return newStream(&rowsSource{rows: rows, scan: scan})
+}
+
+type sqlBatchOp struct {
+	terminalOp
+	l         sync.Mutex
+	db        *sql.DB
+	batchSize int
+	exec      BatchFunc
+	batch     []interface{}
+	err       error
+}
+
+func (s *sqlBatchOp) begin(_ int) {
+	s.batch = make([]interface{}, 0, s.batchSize)
+}
+
+// flush writes the buffered batch within a transaction
+func (s *sqlBatchOp) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = s.exec(tx, s.batch); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	s.batch = make([]interface{}, 0, s.batchSize) // exec may keep the batch it received
+	return nil
+}
+
+func (s *sqlBatchOp) accept(t interface{}) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.batch = append(s.batch, t)
+	if len(s.batch) >= s.batchSize {
+		s.err = s.flush()
+	}
+}
+
+func (s *sqlBatchOp) cancellationRequested() bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.err != nil
+}
+
+func (s *sqlBatchOp) end() {
+	s.terminalOp.end()
+	if s.err == nil && s.Err() == nil {
+		s.err = s.flush()
+	}
+}
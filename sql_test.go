@@ -0,0 +1,209 @@
+package stream
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeStore is the state shared by all connections of a fake database
+type fakeStore struct {
+	mu         sync.Mutex
+	rows       [][]driver.Value
+	inserted   [][]driver.Value
+	commits    int
+	rollbacks  int
+	rowsClosed bool
+}
+
+var (
+	fakeStores = make(map[string]*fakeStore)
+	fakeOnce   sync.Once
+)
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{store: fakeStores[name]}, nil
+}
+
+type fakeConn struct {
+	store *fakeStore
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{store: c.store}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{store: c.store}, nil
+}
+
+type fakeTx struct {
+	store *fakeStore
+}
+
+func (t *fakeTx) Commit() error {
+	t.store.mu.Lock()
+	t.store.commits++
+	t.store.mu.Unlock()
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.store.mu.Lock()
+	t.store.rollbacks++
+	t.store.mu.Unlock()
+	return nil
+}
+
+type fakeStmt struct {
+	store *fakeStore
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.store.mu.Lock()
+	s.store.inserted = append(s.store.inserted, args)
+	s.store.mu.Unlock()
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(_ []driver.Value) (driver.Rows, error) {
+	return &fakeRows{store: s.store}, nil
+}
+
+type fakeRows struct {
+	store *fakeStore
+	pos   int
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id", "user_name", "ignored"}
+}
+
+func (r *fakeRows) Close() error {
+	r.store.mu.Lock()
+	r.store.rowsClosed = true
+	r.store.mu.Unlock()
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.store.rows) {
+		return io.EOF
+	}
+	copy(dest, r.store.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+func openFakeDB(t *testing.T, rows [][]driver.Value) (*sql.DB, *fakeStore) {
+	fakeOnce.Do(func() {
+		sql.Register("stream-fake", fakeDriver{})
+	})
+	store := &fakeStore{rows: rows}
+	fakeStores[t.Name()] = store
+	db, err := sql.Open("stream-fake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, store
+}
+
+type user struct {
+	ID   int64
+	Name string `db:"user_name"`
+}
+
+func TestFromRows(t *testing.T) {
+	db, store := openFakeDB(t, [][]driver.Value{{int64(1), "alice", "x"}, {int64(2), "bob", "y"}, {int64(3), "carol", "z"}})
+	defer db.Close()
+
+	rows, err := db.Query("select")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := FromRows(rows, ScanStruct(user{}))
+	got := s.Collect()
+	if len(got) != 3 || got[1].(user) != (user{2, "bob"}) || s.Err() != nil {
+		t.Fatalf("unexpected users %v, err %v", got, s.Err())
+	}
+	if !store.rowsClosed {
+		t.Fatal("rows should be closed on completion")
+	}
+
+	store.rowsClosed = false
+	rows, _ = db.Query("select")
+	first := FromRows(rows, ScanStruct(&user{})).First()
+	if first.(*user).Name != "alice" || !store.rowsClosed {
+		t.Fatalf("unexpected first %v, rows closed %v", first, store.rowsClosed)
+	}
+
+	rows, _ = db.Query("select")
+	s = FromRows(rows, func(rows *sql.Rows) (interface{}, error) {
+		return nil, errors.New("scan failed")
+	})
+	if s.Count(); s.Err() == nil {
+		t.Fatal("expect scan error")
+	}
+}
+
+func TestToSQLBatches(t *testing.T) {
+	db, store := openFakeDB(t, nil)
+	defer db.Close()
+
+	insert := func(tx *sql.Tx, batch []interface{}) error {
+		for _, v := range batch {
+			if _, err := tx.Exec("insert", v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := Of(1, 2, 3, 4, 5).ToSQLBatches(db, 2, insert); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.inserted) != 5 || store.commits != 3 {
+		t.Fatalf("expect 5 inserts in 3 commits, got %d in %d", len(store.inserted), store.commits)
+	}
+
+	err := Of(1, 2, 3).ToSQLBatches(db, 2, func(tx *sql.Tx, batch []interface{}) error {
+		return errors.New("insert failed")
+	})
+	if err == nil || store.rollbacks != 1 {
+		t.Fatalf("expect error and rollback, got %v and %d rollbacks", err, store.rollbacks)
+	}
+
+	kept := make([][]interface{}, 0)
+	err = Of(1, 2, 3, 4, 5).ToSQLBatches(db, 2, func(tx *sql.Tx, batch []interface{}) error {
+		kept = append(kept, batch)
+		return nil
+	})
+	expect := [][]interface{}{{1, 2}, {3, 4}, {5}}
+	if err != nil || !reflect.DeepEqual(kept, expect) {
+		t.Fatalf("expect batches kept by exec untouched %v, got %v, error %v", expect, kept, err)
+	}
+
+	defer func() {
+		if p := recover(); p == nil {
+			t.Fatal("expect panic for batch size 0")
+		}
+	}()
+	Of(1).ToSQLBatches(db, 0, insert)
+}
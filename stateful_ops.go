@@ -1,8 +1,12 @@
 package stream
 
 import (
+	"hash/fnv"
+	"math"
+	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 type statefulOp struct {
@@ -10,162 +14,386 @@ type statefulOp struct {
 	l sync.Mutex // for parallel stream synchronization
 }
 
+// concurrentShards returns the count of shards of a stage which runs concurrently,
+// it is a variable so that tests could exercise sharding on a single processor
+var concurrentShards = func() int {
+	return runtime.GOMAXPROCS(0)
+}
+
+// shardCount returns how many shards a stage splits its state into, stages after Parallel
+// or PartitionBy keep one shard per processor so workers seldom wait for the same lock
+func (b *baseStage) shardCount() int {
+	if b.node == nil || !b.node.concurrent {
+		return 1
+	}
+	return concurrentShards()
+}
+
+// roundRobin spreads elements over shards in turn
+type roundRobin struct {
+	count uint64
+}
+
+// next returns the shard of the next element
+func (r *roundRobin) next(shards int) int {
+	if shards == 1 {
+		return 0
+	}
+	return int((atomic.AddUint64(&r.count, 1) - 1) % uint64(shards))
+}
+
+// shardOf picks the shard of a key, keys equal to each other fall in the same shard.
+// Only golang built in scalar types are hashed, since other types equal to each other
+// may look different, they all fall in the first shard
+func shardOf(key interface{}, shards int) int {
+	if shards == 1 {
+		return 0
+	}
+	var hash uint64
+	switch val := key.(type) {
+	case string:
+		h := fnv.New64a()
+		h.Write([]byte(val))
+		hash = h.Sum64()
+	case int:
+		hash = uint64(val)
+	case int64:
+		hash = uint64(val)
+	case int32:
+		hash = uint64(val)
+	case int16:
+		hash = uint64(val)
+	case int8:
+		hash = uint64(val)
+	case uint:
+		hash = uint64(val)
+	case uint64:
+		hash = val
+	case uint32:
+		hash = uint64(val)
+	case uint16:
+		hash = uint64(val)
+	case uint8:
+		hash = uint64(val)
+	case bool:
+		if val {
+			hash = 1
+		}
+	case float64:
+		if val != 0 { // -0 equals 0 but has other bits
+			hash = math.Float64bits(val)
+		}
+	case float32:
+		if val != 0 {
+			hash = uint64(math.Float32bits(val))
+		}
+	default:
+		return 0
+	}
+	return int(mix64(hash) % uint64(shards))
+}
+
 type skipperOp struct {
 	statefulOp
 	skipSize  int
-	skipCount int
+	skipCount int64
 }
 
 func (s *skipperOp) begin(size int) {
-	s.downStream.begin(size - s.skipSize)
+	if size > s.skipSize {
+		s.downStream.begin(size - s.skipSize)
+	} else {
+		s.downStream.begin(0)
+	}
 }
 
 func (s *skipperOp) accept(t interface{}) {
-	s.l.Lock()
-	if s.skipCount >= s.skipSize && !s.downStream.cancellationRequested() {
-		s.l.Unlock()
+	skip := int64(s.skipSize)
+	if atomic.LoadInt64(&s.skipCount) < skip && atomic.AddInt64(&s.skipCount, 1) <= skip {
+		return
+	}
+	if !s.stopRequested() {
 		s.downStream.accept(t)
-	} else {
-		s.skipCount++
-		s.l.Unlock()
 	}
 }
 
+// sortShard is a part of the elements to sort, it is sorted on its own and merged at end
+type sortShard struct {
+	l    sync.Mutex
+	data []interface{}
+}
+
 type sorterOp struct {
 	statefulOp
 	comparator ComparatorFunc
-	data       []interface{}
+	shards     []sortShard
+	rr         roundRobin
 }
 
 func (s *sorterOp) begin(size int) {
-	if size > 0 {
-		s.data = make([]interface{}, 0, size)
-	} else {
-		s.data = make([]interface{}, 0)
+	if s.node.skipped {
+		s.downStream.begin(size)
+		return
+	}
+	s.shards = make([]sortShard, s.shardCount())
+	for idx := range s.shards {
+		if size > 0 {
+			s.shards[idx].data = make([]interface{}, 0, size/len(s.shards)+1)
+		} else {
+			s.shards[idx].data = make([]interface{}, 0)
+		}
 	}
 }
 
 func (s *sorterOp) accept(t interface{}) {
-	s.l.Lock()
-	s.data = append(s.data, t)
-	s.l.Unlock()
+	if s.node.skipped {
+		s.downStream.accept(t)
+		return
+	}
+	shard := &s.shards[s.rr.next(len(s.shards))]
+	shard.l.Lock()
+	shard.data = append(shard.data, t)
+	shard.l.Unlock()
 }
 
 func (s *sorterOp) end() {
-	sort.Slice(s.data, func(i, j int) bool {
-		return s.comparator(s.data[i], s.data[j]) <= 0
-	})
-	s.downStream.begin(len(s.data))
-	for idx := range s.data {
-		if s.downStream.cancellationRequested() { // check first, since accept may be called many times by upstream
-			break
+	if s.node.skipped {
+		s.downStream.end()
+		return
+	}
+	total := 0
+	for idx := range s.shards {
+		total += len(s.shards[idx].data)
+	}
+	if len(s.shards) == 1 {
+		s.sortShard(s.shards[0].data)
+	} else {
+		s.sortShards()
+	}
+	s.downStream.begin(total)
+	if len(s.shards) == 1 {
+		data := s.shards[0].data
+		for idx := range data {
+			if s.stopRequested() { // check first, since accept may be called many times by upstream
+				break
+			}
+			s.downStream.accept(data[idx])
+		}
+	} else {
+		h := &runHeap{comparator: s.comparator}
+		for idx := range s.shards {
+			h.runs = append(h.runs, &sliceRun{data: s.shards[idx].data})
+		}
+		h.init()
+		for h.Len() > 0 && !s.stopRequested() {
+			v, _ := h.pop() // runs in memory never fail
+			s.downStream.accept(v)
 		}
-		s.downStream.accept(s.data[idx])
 	}
+	s.shards = nil
 	s.downStream.end()
 }
 
+func (s *sorterOp) sortShard(data []interface{}) {
+	sort.Slice(data, func(i, j int) bool {
+		return s.comparator(data[i], data[j]) <= 0
+	})
+}
+
+// sortShards sorts every shard on its own goroutine, a panic of comparator is
+// raised again on the calling goroutine
+func (s *sorterOp) sortShards() {
+	var wg sync.WaitGroup
+	panics := make([]interface{}, len(s.shards))
+	for idx := range s.shards {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			defer func() {
+				panics[idx] = recover()
+			}()
+			s.sortShard(s.shards[idx].data)
+		}(idx)
+	}
+	wg.Wait()
+	for _, p := range panics {
+		if p != nil {
+			panic(p)
+		}
+	}
+}
+
+func (s *sorterOp) cancellationRequested() bool {
+	return s.node.skipped && s.stopRequested()
+}
+
 type limitOp struct {
 	statefulOp
 	limitSize  int
-	limitCount int
+	limitCount int64
 }
 
-func (l *limitOp) begin(_ int) {
-	l.downStream.begin(l.limitSize)
+func (l *limitOp) begin(size int) {
+	if (size > 0 || l.sizeExact()) && size < l.limitSize {
+		l.downStream.begin(size)
+	} else {
+		l.downStream.begin(l.limitSize)
+	}
 }
 
 func (l *limitOp) accept(t interface{}) {
-	l.l.Lock()
-	l.limitCount++
-	l.l.Unlock()
-	if !l.downStream.cancellationRequested() {
+	if atomic.AddInt64(&l.limitCount, 1) <= int64(l.limitSize) && !l.stopRequested() {
 		l.downStream.accept(t)
 	}
 }
 
 func (l *limitOp) cancellationRequested() bool {
-	l.l.Lock()
-	defer l.l.Unlock()
-	return l.limitCount >= l.limitSize
+	return atomic.LoadInt64(&l.limitCount) >= int64(l.limitSize)
+}
+
+// distinctShard holds the distinct elements of one shard
+type distinctShard struct {
+	l   sync.Mutex
+	set map[interface{}]interface{}
+}
+
+// newDistinctShards creates the shards of distinctOp and funcDistinctOp
+func newDistinctShards(count int) []distinctShard {
+	shards := make([]distinctShard, count)
+	for idx := range shards {
+		shards[idx].set = make(map[interface{}]interface{})
+	}
+	return shards
+}
+
+// distinctSize counts the distinct elements of all shards
+func distinctSize(shards []distinctShard) int {
+	size := 0
+	for idx := range shards {
+		size += len(shards[idx].set)
+	}
+	return size
 }
 
 type distinctOp struct {
 	statefulOp
-	set map[interface{}]struct{} // temp storage
+	shards []distinctShard // temp storage, elements are sharded by hash
 }
 
-func (d *distinctOp) begin(_ int) {
-	d.set = make(map[interface{}]struct{})
+func (d *distinctOp) begin(size int) {
+	if d.node.skipped {
+		d.downStream.begin(size)
+		return
+	}
+	d.shards = newDistinctShards(d.shardCount())
 }
 
 func (d *distinctOp) accept(t interface{}) {
-	d.set[t] = struct{}{}
+	if d.node.skipped {
+		d.downStream.accept(t)
+		return
+	}
+	shard := &d.shards[shardOf(t, len(d.shards))]
+	shard.l.Lock()
+	shard.set[t] = t
+	shard.l.Unlock()
+}
+
+func (d *distinctOp) cancellationRequested() bool {
+	return d.node.skipped && d.stopRequested()
 }
 
 func (d *distinctOp) end() {
-	d.downStream.begin(len(d.set))
-	for key := range d.set {
-		if d.downStream.cancellationRequested() {
-			break
+	if d.node.skipped {
+		d.downStream.end()
+		return
+	}
+	d.downStream.begin(distinctSize(d.shards))
+	for idx := range d.shards {
+		for key := range d.shards[idx].set {
+			if d.stopRequested() {
+				break
+			}
+			d.downStream.accept(key)
 		}
-		d.downStream.accept(key)
 	}
+	d.shards = nil
 	d.downStream.end()
 }
 
 type funcDistinctOp struct {
 	statefulOp
-	set map[interface{}]interface{}
-	fn  DistinctFunc
+	shards []distinctShard // elements are sharded by hash of their keys
+	fn     DistinctFunc
 }
 
 func (f *funcDistinctOp) begin(_ int) {
-	f.set = make(map[interface{}]interface{})
+	f.shards = newDistinctShards(f.shardCount())
 }
 
 func (f *funcDistinctOp) accept(t interface{}) {
-	f.set[f.fn(t)] = t
+	key := f.fn(t)
+	shard := &f.shards[shardOf(key, len(f.shards))]
+	shard.l.Lock()
+	shard.set[key] = t
+	shard.l.Unlock()
 }
 
 func (f *funcDistinctOp) end() {
-	f.downStream.begin(len(f.set))
-	for _, v := range f.set {
-		if f.downStream.cancellationRequested() {
-			break
+	f.downStream.begin(distinctSize(f.shards))
+	for idx := range f.shards {
+		for _, v := range f.shards[idx].set {
+			if f.stopRequested() {
+				break
+			}
+			f.downStream.accept(v)
 		}
-		f.downStream.accept(v)
 	}
+	f.shards = nil
 	f.downStream.end()
 }
 
+// groupShard holds the groups whose keys fall in one shard
+type groupShard struct {
+	l      sync.Mutex
+	groups map[interface{}][]interface{}
+}
+
 type GroupOp struct {
 	statefulOp
 	groupFunc GroupFunc
-	groups    map[interface{}][]interface{}
+	shards    []groupShard // groups are sharded by hash of their keys
 }
 
 func (g *GroupOp) begin(_ int) {
-	g.groups = make(map[interface{}][]interface{})
+	g.shards = make([]groupShard, g.shardCount())
+	for idx := range g.shards {
+		g.shards[idx].groups = make(map[interface{}][]interface{})
+	}
 }
 
 func (g *GroupOp) accept(t interface{}) {
 	key := g.groupFunc(t)
-	if g.groups[key] == nil {
-		g.groups[key] = make([]interface{}, 0)
-	}
-	g.l.Lock()
-	g.groups[key] = append(g.groups[key], t)
-	g.l.Unlock()
+	shard := &g.shards[shardOf(key, len(g.shards))]
+	shard.l.Lock()
+	shard.groups[key] = append(shard.groups[key], t)
+	shard.l.Unlock()
 }
 
 func (g *GroupOp) end() {
-	g.downStream.begin(len(g.groups))
-	for _, value := range g.groups {
-		if g.downStream.cancellationRequested() {
-			break
+	size := 0
+	for idx := range g.shards {
+		size += len(g.shards[idx].groups)
+	}
+	g.downStream.begin(size)
+	for idx := range g.shards {
+		for _, value := range g.shards[idx].groups {
+			if g.stopRequested() {
+				break
+			}
+			g.downStream.accept(value)
 		}
-		g.downStream.accept(value)
 	}
+	g.shards = nil
 	g.downStream.end()
 }
@@ -0,0 +1,169 @@
+package stream
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+func intComparator(a, b interface{}) int {
+	return a.(int) - b.(int)
+}
+
+// repeated returns 0 to n-1 times times each
+func repeated(n, times int) []interface{} {
+	data := make([]interface{}, 0, n*times)
+	for idx := 0; idx < n*times; idx++ {
+		data = append(data, idx%n)
+	}
+	return data
+}
+
+// withShards makes stages after Parallel keep n shards until the test ends
+func withShards(t *testing.T, n int) {
+	saved := concurrentShards
+	concurrentShards = func() int { return n }
+	t.Cleanup(func() {
+		concurrentShards = saved
+	})
+}
+
+func TestParallelSort(t *testing.T) {
+	withShards(t, 4)
+	data := make([]interface{}, 0, 1000)
+	for idx := 1000; idx > 0; idx-- {
+		data = append(data, idx)
+	}
+	got := New(data).Parallel().Sort(intComparator).Collect()
+	if len(got) != 1000 {
+		t.Fatalf("expect 1000 elements, got %d", len(got))
+	}
+	for idx := range got {
+		if got[idx] != idx+1 {
+			t.Fatalf("element %d out of order: %v", idx, got[idx])
+		}
+	}
+	if got := New(data).Parallel().Sort(intComparator).Limit(3).Collect(); len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Fatalf("unexpected head of sorted stream %v", got)
+	}
+}
+
+func TestSortComparatorPanic(t *testing.T) {
+	withShards(t, 4)
+	cmp := func(a, b interface{}) int {
+		panic("cmp boom")
+	}
+	for _, s := range []Stream{Of(3, 1, 2).Sort(cmp), New(dataGenerator()).Parallel().Sort(cmp)} {
+		func() {
+			defer func() {
+				if p := recover(); p != "cmp boom" {
+					t.Fatalf("expect panic of comparator, got %v", p)
+				}
+			}()
+			s.Collect()
+		}()
+	}
+}
+
+func TestParallelDistinct(t *testing.T) {
+	withShards(t, 4)
+	got := New(repeated(100, 20)).Parallel().Distinct().Collect()
+	ints := make([]int, 0, len(got))
+	for idx := range got {
+		ints = append(ints, got[idx].(int))
+	}
+	sort.Ints(ints)
+	if len(ints) != 100 || ints[0] != 0 || ints[99] != 99 {
+		t.Fatalf("unexpected distinct elements %v", ints)
+	}
+	if n := New([]float64{0, 1, 2}).Parallel().FlatMap(func(v interface{}) []interface{} {
+		return []interface{}{v, -v.(float64)}
+	}).Distinct().Count(); n != 5 {
+		t.Fatalf("expect 0 and -0 seen as equal, got %d elements", n)
+	}
+	type point struct {
+		x float64
+		y int
+	}
+	if n := New(repeated(10, 10)).Parallel().Map(func(v interface{}) interface{} {
+		if v.(int)%2 == 0 {
+			return point{x: 0, y: v.(int) % 3}
+		}
+		return point{x: math.Copysign(0, -1), y: v.(int) % 3} // equals the point with x 0
+	}).Distinct().Count(); n != 3 {
+		t.Fatalf("expect 3 distinct points, got %d", n)
+	}
+	if n := New(repeated(50, 10)).Parallel().DistinctByFunc(func(v interface{}) interface{} {
+		return v.(int) % 10
+	}).Count(); n != 10 {
+		t.Fatalf("expect 10 distinct keys, got %d", n)
+	}
+}
+
+func TestShardOf(t *testing.T) {
+	pairs := [][2]interface{}{
+		{"a", "a"}, {7, 7}, {int64(7), int64(7)}, {int32(7), int32(7)}, {int16(7), int16(7)}, {int8(7), int8(7)},
+		{uint(7), uint(7)}, {uint64(7), uint64(7)}, {uint32(7), uint32(7)}, {uint16(7), uint16(7)}, {uint8(7), uint8(7)},
+		{true, true}, {1.5, 1.5}, {0.0, math.Copysign(0, -1)}, {float32(0), float32(math.Copysign(0, -1))},
+		{[2]int{1, 2}, [2]int{1, 2}},
+	}
+	for _, pair := range pairs {
+		if a, b := shardOf(pair[0], 8), shardOf(pair[1], 8); a != b || a < 0 || a >= 8 {
+			t.Fatalf("expect %v and %v in the same shard, got %d and %d", pair[0], pair[1], a, b)
+		}
+	}
+	used := make(map[int]bool)
+	for idx := 0; idx < 100; idx++ {
+		used[shardOf(idx, 8)] = true
+	}
+	if len(used) != 8 {
+		t.Fatalf("expect keys spread over 8 shards, got %d", len(used))
+	}
+}
+
+func TestParallelGroup(t *testing.T) {
+	withShards(t, 4)
+	groups := New(repeated(10, 30)).Parallel().Group(func(v interface{}) interface{} {
+		return v
+	}).Collect()
+	if len(groups) != 10 {
+		t.Fatalf("expect 10 groups, got %d", len(groups))
+	}
+	for idx := range groups {
+		group := groups[idx].([]interface{})
+		if len(group) != 30 {
+			t.Fatalf("expect 30 elements in group, got %d", len(group))
+		}
+		for _, v := range group {
+			if v != group[0] {
+				t.Fatalf("unexpected element %v in group of %v", v, group[0])
+			}
+		}
+	}
+}
+
+func TestParallelSkipLimit(t *testing.T) {
+	withShards(t, 4)
+	count := func(s Stream) int {
+		var n int64
+		s.ForEach(func(_ interface{}) {
+			atomic.AddInt64(&n, 1)
+		})
+		return int(n)
+	}
+	if n := count(New(dataGenerator()).Parallel().Skip(50)); n != 150 {
+		t.Fatalf("expect 150 elements after skip, got %d", n)
+	}
+	if n := count(New(dataGenerator()).Parallel().Limit(50)); n != 50 {
+		t.Fatalf("expect 50 elements after limit, got %d", n)
+	}
+}
+
+func BenchmarkParallelDistinct(b *testing.B) {
+	data := repeated(1000, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		New(data).Parallel().Distinct().Count()
+	}
+}
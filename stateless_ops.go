@@ -5,12 +5,8 @@ type filterOp struct {
 	filterFunc FilterFunc
 }
 
-func (f *filterOp) begin(_ int) {
-	f.downStream.begin(0)
-}
-
 func (f *filterOp) accept(t interface{}) {
-	if f.downStream.cancellationRequested() {
+	if f.stopRequested() {
 		return
 	}
 	if f.filterFunc(t) {
@@ -24,7 +20,7 @@ type mapperOp struct {
 }
 
 func (m *mapperOp) accept(t interface{}) {
-	if !m.downStream.cancellationRequested() {
+	if !m.stopRequested() {
 		m.downStream.accept(m.mapperFunc(t))
 	}
 }
@@ -41,7 +37,7 @@ func (f *flatMapperOp) begin(_ int) {
 func (f *flatMapperOp) accept(t interface{}) {
 	flatted := f.flatMapFunc(t)
 	for idx := range flatted {
-		if f.downStream.cancellationRequested() {
+		if f.stopRequested() {
 			break
 		}
 		f.downStream.accept(flatted[idx])
@@ -1,13 +1,20 @@
 package stream
 
 import (
+	"database/sql"
+	"io"
+	"math"
+	"math/rand"
 	"reflect"
+	"sync"
+	"time"
 )
 
 // sink links different stages in a stream
 // stream operations should implement this interface to perform data processing
 type sink interface {
-	// begin should be call before send data to current stage
+	// begin should be call before send data to current stage, size is the exact count of
+	// data if the stage receives Sized data, otherwise it is an estimate, non-positive means unknown
 	begin(size int)
 	// end is used to notify current stage that data sending is done
 	end()
@@ -24,10 +31,33 @@ type ForEachFunc func(interface{})
 type GroupFunc func(interface{}) interface{}
 type DistinctFunc func(interface{}) interface{}
 
+// KeyFunc extracts the key used to match elements of two streams
+type KeyFunc func(interface{}) interface{}
+
+// JoinFunc combines two matched elements into one,
+// the missing side of an outer join is passed as nil
+type JoinFunc func(left interface{}, right interface{}) interface{}
+
 // ComparatorFunc compares two elements, if a < b return -1, if
 // a = b return 0, if a > b return 1
 type ComparatorFunc func(a interface{}, b interface{}) int
 
+// AsyncMapFunc transforms an element like MapFunc, or returns an error if the element fails.
+// It is used by MapAsync, which may call it concurrently, and MapWithRetry
+type AsyncMapFunc func(interface{}) (interface{}, error)
+
+// ErrorReturnFunc returns the element which replaces the error stopped a stream
+type ErrorReturnFunc func(err error) interface{}
+
+// ErrorResumeFunc returns the Stream whose elements replace the error stopped a stream
+type ErrorResumeFunc func(err error) Stream
+
+// TimestampFunc extracts the event time of an element
+type TimestampFunc func(interface{}) time.Time
+
+// NumberFunc extracts the number used to summarize an element
+type NumberFunc func(interface{}) float64
+
 type ReduceFunc func(in []interface{}, out interface{}) error
 
 // Stream defines all possible stream operations
@@ -48,10 +78,79 @@ type Stream interface {
 	Limit(n int) Stream
 	// Sort uses a given ComparatorFunc to sort data
 	Sort(comparator ComparatorFunc) Stream
+	// SortWith sorts data like Sort, but spills sorted runs to disk once more than
+	// SortOptions.MaxInMemory elements are buffered, then merges them lazily
+	SortWith(comparator ComparatorFunc, opts SortOptions) Stream
+	// Sample passes a uniform random sample of at most k elements to next stage using
+	// reservoir sampling, rng is used as random source, a time seeded one is used if it is nil.
+	// It panics if k is negative
+	Sample(k int, rng *rand.Rand) Stream
+	// SampleFraction passes each element to next stage with probability p, it panics unless p is in [0, 1]
+	SampleFraction(p float64, rng *rand.Rand) Stream
+	// Shuffle passes data to next stage in random order
+	Shuffle(rng *rand.Rand) Stream
 	// Group uses a given GroupFunc to split data into multiple groups
 	// the order of data passes to next stage is not guaranteed
 	Group(grouper GroupFunc) Stream
-	// Parallel convert a Stream into paralleled Stream, uses parallel go routine to process Stream function
+	// Join emits combined pairs of elements from this and the other Stream whose keys are equal,
+	// the smaller stream is hashed if size is known, the order of data is not guaranteed
+	Join(other Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Stream
+	// LeftJoin is like Join, but elements of this Stream without match are combined with nil
+	LeftJoin(other Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Stream
+	// RightJoin is like Join, but elements of the other Stream without match are combined with nil
+	RightJoin(other Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Stream
+	// FullOuterJoin is like Join, but elements of both Streams without match are combined with nil
+	FullOuterJoin(other Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Stream
+	// CoGroup groups elements of this and the other Stream by key, and emits a CoGroupResult for each key
+	CoGroup(other Stream, leftKey KeyFunc, rightKey KeyFunc) Stream
+	// Tee splits the stream into n branches, every branch receives all the data in one traversal.
+	// A terminal operation must be called on each branch on its own goroutine, data is sent once all
+	// branches are started, and stops once all branches are done. See Broadcast for a simpler usage
+	Tee(n int) []Stream
+	// Via adds a user defined Operator as the next stage
+	Via(op Operator) Stream
+	// MapAsync transforms data like Map, but runs AsyncMapFunc on its own goroutines with at most
+	// concurrency calls in flight, the stages after it are still called sequentially. Results are
+	// passed in the order they complete, errors are handled by the ErrorStrategy of stream
+	MapAsync(concurrency int, fn AsyncMapFunc) Stream
+	// MapAsyncOrdered is like MapAsync, but passes results in the order of elements
+	MapAsyncOrdered(concurrency int, fn AsyncMapFunc) Stream
+	// MapWithRetry transforms data like Map, a failed call of AsyncMapFunc is retried as RetryPolicy
+	// decides, the backoff waits on the clock of stream. The last error of an element is handled by
+	// the ErrorStrategy of stream
+	MapWithRetry(fn AsyncMapFunc, policy RetryPolicy) Stream
+	// OnErrorReturn handles the error stopped the stages before it, the error is cleared and the
+	// element returned by ErrorReturnFunc is passed to next stage
+	OnErrorReturn(fn ErrorReturnFunc) Stream
+	// OnErrorResume handles the error stopped the stages before it, the error is cleared and the
+	// elements of the Stream returned by ErrorResumeFunc are passed to next stage
+	OnErrorResume(fn ErrorResumeFunc) Stream
+	// RateLimit passes at most n elements per duration to next stage, it waits for elements beyond
+	// the rate, and allows a burst of n elements after idle time. Waits stop when the stream is cancelled
+	RateLimit(n int, per time.Duration) Stream
+	// Throttle passes the first element of every interval to next stage and drops the others,
+	// it panics if interval is not positive
+	Throttle(interval time.Duration) Stream
+	// Debounce passes an element to next stage only if no other element follows it in quiet
+	// duration, the last element is passed once the stream is done. It panics if quiet is not positive
+	Debounce(quiet time.Duration) Stream
+	// Delay pauses d before passing each element to next stage, the pause stops when the stream is
+	// cancelled. It panics if d is not positive
+	Delay(d time.Duration) Stream
+	// TumblingWindow groups elements into Window of size by their timestamps, windows do not overlap
+	TumblingWindow(size time.Duration, opts WindowOptions) Stream
+	// SlidingWindow groups elements into Window of size which starts every slide, an element belongs
+	// to every window covers its timestamp
+	SlidingWindow(size time.Duration, slide time.Duration, opts WindowOptions) Stream
+	// SessionWindow groups elements into Window of sessions, a session ends once no element arrives
+	// in gap duration
+	SessionWindow(gap time.Duration, opts WindowOptions) Stream
+	// PartitionBy processes the stages after it on workers goroutines, elements are sent to the worker
+	// chosen by the hash of their key, so elements of the same key are processed in order by one worker.
+	// Workers pass elements to the stages after it one at a time, which receive elements of all workers
+	PartitionBy(key KeyFunc, workers int) Stream
+	// Parallel convert a Stream into paralleled Stream, uses parallel go routine to process Stream function.
+	// Distinct, Sort and Group after it keep state in per processor shards which are merged at end
 	Parallel() Stream
 	// ForEach will call the given ForEachFunc to every element it received
 	ForEach(foeEach ForEachFunc)
@@ -67,8 +166,69 @@ type Stream interface {
 	First() interface{}
 	// Last returns the last element in stream or nil
 	Last() interface{}
+	// ApproxCountDistinct estimates the count of distinct elements in stream use HyperLogLog
+	// with 2^precision registers, precision should be in range [4, 18], the standard error
+	// of estimation is about 1.04/sqrt(2^precision)
+	ApproxCountDistinct(precision int) int
+	// ApproxQuantiles estimates the value of each quantile in qs, which should be in range [0, 1],
+	// elements in stream should be numbers, NaN is returned for every quantile of empty stream
+	ApproxQuantiles(qs ...float64) []float64
+	// ApproxTopFrequent estimates the k most frequent elements in stream use space-saving
+	// algorithm, the result is ordered by count descending, k should be positive
+	ApproxTopFrequent(k int) []FrequentItem
+	// Percentiles returns the value of each percentage in ps, which should be in range [0, 100],
+	// of numbers extracted by key, values between closest ranks are linear interpolated.
+	// It returns the error of stream, and panics if any percentage is out of range
+	Percentiles(key NumberFunc, ps ...float64) ([]Percentile, error)
+	// Median returns the median of numbers extracted by key, NaN is returned if stream is empty,
+	// it returns the error of stream as well
+	Median(key NumberFunc) (float64, error)
+	// Histogram counts numbers extracted by key into buckets with the given upper bounds, it
+	// returns the error of stream, and panics if bounds are not in ascending order
+	Histogram(key NumberFunc, bounds []float64) (Histogram, error)
+	// ToCSV writes struct, map or []string elements to w as csv records,
+	// it returns the first error occurred while encoding or writing
+	ToCSV(w io.Writer, opts CSVOptions) error
+	// ToJSONLines writes each element to w as a line of json, an element could not be encoded
+	// is handled by the ErrorStrategy of stream, which returns it as an *ElementError by default.
+	// An error of w fails the stream whatever the ErrorStrategy is
+	ToJSONLines(w io.Writer) error
+	// ToMap puts Entry elements into the map out points to, the map is created if it is nil,
+	// policy decides what to do with entries having the same key
+	ToMap(out interface{}, policy DuplicatePolicy) error
+	// ToSQLBatches writes elements to db in batches of batchSize use exec, each batch is
+	// written within its own transaction, which is rolled back if exec fails. It panics if batchSize
+	// is not positive
+	ToSQLBatches(db *sql.DB, batchSize int, exec BatchFunc) error
+	// ToChannel runs the stream on a new goroutine and sends elements to the returned channel,
+	// which has a buffer of bufSize and is closed when the stream is done. Future reports the
+	// error of stream and cancels it, the channel should be drained or the Future cancelled
+	ToChannel(bufSize int) (<-chan interface{}, *Future)
+	// Async gives terminal operations which run on a new goroutine and return a Future
+	Async() AsyncStream
+	// Into sends data to a user defined terminal Sink, and returns the error of stream, or the
+	// error of terminal if it is an ErrorSink. Calls to terminal are serialized after Parallel,
+	// unless it is a FlaggedSink declaring ParallelSafe
+	Into(terminal Sink) error
 	// Reduce uses the ReduceFunc to collect elements in stream
 	Reduce(into ReduceFunc, out interface{}) error
+	// WithObserver registers an Observer which receives events of every stage of the stream,
+	// it should be called before the terminal operation
+	WithObserver(o Observer) Stream
+	// WithErrorStrategy sets the ErrorStrategy which decides what error aware stages do with elements
+	// they failed to process, FailFast is used by default. It should be called before the terminal operation
+	WithErrorStrategy(strategy ErrorStrategy) Stream
+	// WithClock replaces the clock used by time based operations of the stream, it should be
+	// called before the terminal operation
+	WithClock(c Clock) Stream
+	// Explain describes the execution plan of the stream: stages with their parameters, the
+	// Characteristics of data after each stage, parallel boundaries, fused and skipped stages
+	Explain() string
+	// Characteristics returns the Characteristics of data the stream sends to next operation
+	Characteristics() Characteristics
+	// Err returns the first error occurred while processing the stream,
+	// it should be checked after the terminal operation returns
+	Err() error
 }
 
 // stage is the abstraction of a stream stage
@@ -79,6 +239,9 @@ type stage interface {
 	getNextSink() sink
 	setStartStage(s *startOp)
 	setNextSink(s sink)
+	getNode() *planNode
+	setNode(n *planNode)
+	setSelf(s stage)
 }
 
 // baseStage implements stage, defines the default behavior of a stage
@@ -88,13 +251,26 @@ type baseStage struct {
 	startStage *startOp
 	downStream sink
 	paralleled bool
+	node       *planNode // description of stage in execution plan
+	self       stage     // the stage embeds baseStage, stream settings return it to keep its own methods
 }
 
-// New wraps the given data array into Stream
+// New wraps the given data array into Stream, a map is wrapped as a Stream of Entry
 func New(data interface{}) Stream {
-	stream := &startOp{}
+	stream := &startOp{cancelled: make(chan struct{})}
 	setStreamData(stream, data)
 	stream.startStage = stream
+	stream.self = stream
+	stream.node = newSourceNode(stream.src)
+	return stream
+}
+
+// newStream creates a Stream reads data from the given source
+func newStream(src source) Stream {
+	stream := &startOp{src: src, cancelled: make(chan struct{})}
+	stream.startStage = stream
+	stream.self = stream
+	stream.node = newSourceNode(src)
 	return stream
 }
 
@@ -115,9 +291,11 @@ func setStreamData(stream *startOp, data interface{}) Stream {
 		for idx := 0; idx < arrValue.Len(); idx++ {
 			dataValue.Set(reflect.Append(dataValue, arrValue.Index(idx)))
 		}
-		stream.data = data
+		stream.src = &sliceSource{data: data}
+	case reflect.Map:
+		stream.src = &mapSource{m: arrValue, project: entryOf, extra: Distinct | NonNull}
 	default:
-		panic("data provides to Stream must be Array or Slice")
+		panic("data provides to Stream must be Array, Slice or Map")
 	}
 	return stream
 }
@@ -156,10 +334,106 @@ func (b *baseStage) Sort(comparator ComparatorFunc) Stream {
 	return wrapSink(b, opSorter, comparator)
 }
 
+func (b *baseStage) SortWith(comparator ComparatorFunc, opts SortOptions) Stream {
+	return wrapSink(b, opExternalSorter, comparator, opts)
+}
+
+func (b *baseStage) Sample(k int, rng *rand.Rand) Stream {
+	return wrapSink(b, opSampler, k, rng)
+}
+
+func (b *baseStage) SampleFraction(p float64, rng *rand.Rand) Stream {
+	return wrapSink(b, opFractionSampler, p, rng)
+}
+
+func (b *baseStage) Shuffle(rng *rand.Rand) Stream {
+	return wrapSink(b, opShuffler, rng)
+}
+
 func (b *baseStage) Group(grouper GroupFunc) Stream {
 	return wrapSink(b, OpGrouper, grouper)
 }
 
+func (b *baseStage) Join(other Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Stream {
+	return wrapSink(b, opJoiner, innerJoin, other, leftKey, rightKey, combine)
+}
+
+func (b *baseStage) LeftJoin(other Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Stream {
+	return wrapSink(b, opJoiner, leftJoin, other, leftKey, rightKey, combine)
+}
+
+func (b *baseStage) RightJoin(other Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Stream {
+	return wrapSink(b, opJoiner, rightJoin, other, leftKey, rightKey, combine)
+}
+
+func (b *baseStage) FullOuterJoin(other Stream, leftKey KeyFunc, rightKey KeyFunc, combine JoinFunc) Stream {
+	return wrapSink(b, opJoiner, fullOuterJoin, other, leftKey, rightKey, combine)
+}
+
+func (b *baseStage) CoGroup(other Stream, leftKey KeyFunc, rightKey KeyFunc) Stream {
+	return wrapSink(b, opCoGrouper, other, leftKey, rightKey)
+}
+
+func (b *baseStage) Tee(n int) []Stream {
+	return wrapSink(b, opTee, n).(*teeOp).streams()
+}
+
+func (b *baseStage) Via(op Operator) Stream {
+	return wrapSink(b, opOperator, op)
+}
+
+func (b *baseStage) MapAsync(concurrency int, fn AsyncMapFunc) Stream {
+	return wrapSink(b, opAsyncMapper, concurrency, fn)
+}
+
+func (b *baseStage) MapAsyncOrdered(concurrency int, fn AsyncMapFunc) Stream {
+	return wrapSink(b, opOrderedAsyncMapper, concurrency, fn)
+}
+
+func (b *baseStage) MapWithRetry(fn AsyncMapFunc, policy RetryPolicy) Stream {
+	return wrapSink(b, opRetryMapper, fn, policy)
+}
+
+func (b *baseStage) OnErrorReturn(fn ErrorReturnFunc) Stream {
+	return wrapSink(b, opErrorReturner, fn)
+}
+
+func (b *baseStage) OnErrorResume(fn ErrorResumeFunc) Stream {
+	return wrapSink(b, opErrorResumer, fn)
+}
+
+func (b *baseStage) RateLimit(n int, per time.Duration) Stream {
+	return wrapSink(b, opRateLimiter, n, per)
+}
+
+func (b *baseStage) Throttle(interval time.Duration) Stream {
+	return wrapSink(b, opThrottler, interval)
+}
+
+func (b *baseStage) Debounce(quiet time.Duration) Stream {
+	return wrapSink(b, opDebouncer, quiet)
+}
+
+func (b *baseStage) Delay(d time.Duration) Stream {
+	return wrapSink(b, opDelayer, d)
+}
+
+func (b *baseStage) TumblingWindow(size time.Duration, opts WindowOptions) Stream {
+	return wrapSink(b, opTumblingWindower, size, size, opts)
+}
+
+func (b *baseStage) SlidingWindow(size time.Duration, slide time.Duration, opts WindowOptions) Stream {
+	return wrapSink(b, opSlidingWindower, size, slide, opts)
+}
+
+func (b *baseStage) SessionWindow(gap time.Duration, opts WindowOptions) Stream {
+	return wrapSink(b, opSessionWindower, gap, gap, opts)
+}
+
+func (b *baseStage) PartitionBy(key KeyFunc, workers int) Stream {
+	return wrapSink(b, opPartitioner, key, workers)
+}
+
 func (b *baseStage) Parallel() Stream {
 	return wrapSink(b, OpParalleled)
 }
@@ -206,12 +480,154 @@ func (b *baseStage) Last() interface{} {
 	return downStream.(*lastOp).val
 }
 
+func (b *baseStage) ApproxCountDistinct(precision int) int {
+	downStream := wrapSink(b, opApproxDistinctCounter, precision)
+	b.startStage.end()
+	return downStream.(*approxDistinctOp).sketch.estimate()
+}
+
+func (b *baseStage) ApproxQuantiles(qs ...float64) []float64 {
+	downStream := wrapSink(b, opApproxQuantiler)
+	b.startStage.end()
+	return downStream.(*approxQuantilesOp).sketch.quantiles(qs)
+}
+
+func (b *baseStage) ApproxTopFrequent(k int) []FrequentItem {
+	downStream := wrapSink(b, opApproxTopFrequenter, k)
+	b.startStage.end()
+	return downStream.(*approxTopFrequentOp).sketch.top(k)
+}
+
+func (b *baseStage) Percentiles(key NumberFunc, ps ...float64) ([]Percentile, error) {
+	checkPercentiles(ps)
+	var res []Percentile
+	err := b.Map(numberMapper(key)).Sort(compareFloat64).Reduce(percentiles(ps), &res)
+	return res, err
+}
+
+func (b *baseStage) Median(key NumberFunc) (float64, error) {
+	res, err := b.Percentiles(key, 50)
+	if len(res) == 0 {
+		return math.NaN(), err
+	}
+	return res[0].Value, err
+}
+
+func (b *baseStage) Histogram(key NumberFunc, bounds []float64) (Histogram, error) {
+	checkBounds(bounds)
+	var res Histogram
+	err := b.Map(numberMapper(key)).Reduce(histogram(bounds), &res)
+	return res, err
+}
+
+func (b *baseStage) ToCSV(w io.Writer, opts CSVOptions) error {
+	downStream := wrapSink(b, opCSVWriter, w, opts)
+	b.startStage.end()
+	if err := b.Err(); err != nil {
+		return err
+	}
+	return downStream.(*csvWriterOp).err
+}
+
+func (b *baseStage) ToJSONLines(w io.Writer) error {
+	downStream := wrapSink(b, opJSONLinesWriter, w)
+	b.startStage.end()
+	if err := b.Err(); err != nil {
+		return err
+	}
+	return downStream.(*jsonLinesWriterOp).err
+}
+
+func (b *baseStage) ToMap(out interface{}, policy DuplicatePolicy) error {
+	downStream := wrapSink(b, opMapCollector, out, policy)
+	b.startStage.end()
+	if err := b.Err(); err != nil {
+		return err
+	}
+	return downStream.(*toMapOp).err
+}
+
+func (b *baseStage) ToSQLBatches(db *sql.DB, batchSize int, exec BatchFunc) error {
+	downStream := wrapSink(b, opSQLBatchWriter, db, batchSize, exec)
+	b.startStage.end()
+	if err := b.Err(); err != nil {
+		return err
+	}
+	return downStream.(*sqlBatchOp).err
+}
+
+func (b *baseStage) ToChannel(bufSize int) (<-chan interface{}, *Future) {
+	ch := make(chan interface{}, bufSize)
+	f := newFuture(b.startStage)
+	wrapSink(b, opChannelSender, ch, f.cancelled)
+	f.run(func() interface{} {
+		defer close(ch)
+		b.startStage.end()
+		return nil
+	})
+	return ch, f
+}
+
+func (b *baseStage) Async() AsyncStream {
+	return asyncStream{b: b}
+}
+
+func (b *baseStage) Into(terminal Sink) error {
+	wrapSink(b, opInto, terminal)
+	b.startStage.end()
+	if err := b.Err(); err != nil {
+		return err
+	}
+	return sinkErr(terminal)
+}
+
 func (b *baseStage) Reduce(reduce ReduceFunc, out interface{}) error {
 	downStream := wrapSink(b, opReduce, reduce, out)
 	b.startStage.end()
+	if err := b.Err(); err != nil {
+		return err
+	}
 	return downStream.(*reduceOp).err
 }
 
+func (b *baseStage) WithObserver(o Observer) Stream {
+	b.startStage.observers = append(b.startStage.observers, o)
+	return b.self
+}
+
+func (b *baseStage) WithErrorStrategy(strategy ErrorStrategy) Stream {
+	b.startStage.strategy = strategy
+	return b.self
+}
+
+func (b *baseStage) WithClock(c Clock) Stream {
+	b.startStage.clock = c
+	return b.self
+}
+
+func (b *baseStage) Explain() string {
+	return explain(b.startStage, b.self)
+}
+
+func (b *baseStage) Characteristics() Characteristics {
+	return b.node.characteristics
+}
+
+func (b *baseStage) Err() error {
+	return b.startStage.getErr()
+}
+
+// fail records err to the stream, which stops the stream from sending further data
+func (b *baseStage) fail(err error) {
+	b.startStage.setErr(err)
+}
+
+// elementFailed handles the error of an element with the ErrorStrategy of stream,
+// it returns true if the stream failed, otherwise the element should be dropped
+func (b *baseStage) elementFailed(err *ElementError) bool {
+	return b.startStage.elementFailed(err)
+}
+
 // implement sink
 func (b *baseStage) begin(size int) {
 	if b.downStream != nil {
@@ -235,6 +651,12 @@ func (b *baseStage) cancellationRequested() bool {
 	return false
 }
 
+// stopRequested reports whether the stage should stop passing data to next stage,
+// since next stage requests cancellation or the stream is cancelled through Future
+func (b *baseStage) stopRequested() bool {
+	return b.downStream.cancellationRequested() || b.startStage.isCancelled()
+}
+
 // implement of stage
 func (b *baseStage) getStartStage() *startOp {
 	return b.startStage
@@ -252,23 +674,135 @@ func (b *baseStage) setNextSink(s sink) {
 	b.downStream = s
 }
 
+func (b *baseStage) getNode() *planNode {
+	return b.node
+}
+
+func (b *baseStage) setNode(n *planNode) {
+	b.node = n
+}
+
+func (b *baseStage) setSelf(s stage) {
+	b.self = s
+}
+
+// sizeExact reports whether the size passed to begin is the exact count of data
+func (b *baseStage) sizeExact() bool {
+	return b.node != nil && b.node.input&Sized != 0
+}
+
 // startOp presents the beginning of a stream
 type startOp struct {
 	baseStage
-	data   []interface{}
-	closed bool
+	src        source
+	closed     bool
+	errL       sync.Mutex
+	err        error
+	observers  []Observer
+	clock      Clock
+	strategy   ErrorStrategy
+	cancelled  chan struct{} // closed by cancel
+	cancelOnce sync.Once
+}
+
+// getClock returns the clock of stream, system clock is used if no one is set
+func (s *startOp) getClock() Clock {
+	if s.clock == nil {
+		return systemClock{}
+	}
+	return s.clock
+}
+
+func (s *startOp) getErr() error {
+	s.errL.Lock()
+	defer s.errL.Unlock()
+	return s.err
+}
+
+// elementFailed handles an element error with the ErrorStrategy of stream,
+// it returns true if the stream failed
+func (s *startOp) elementFailed(err *ElementError) bool {
+	strategy := s.strategy
+	if strategy == nil {
+		strategy = FailFast
+	}
+	if e := strategy.handle(err); e != nil {
+		s.setErr(e)
+		return true
+	}
+	return false
+}
+
+// clearErr forgets the error handled by a stage
+func (s *startOp) clearErr() {
+	s.errL.Lock()
+	s.err = nil
+	s.errL.Unlock()
+}
+
+// cancel fails the stream with ErrCancelled, and makes every stage stop passing data
+// even if it has data buffered
+func (s *startOp) cancel() {
+	s.setErr(ErrCancelled)
+	s.cancelOnce.Do(func() {
+		close(s.cancelled)
+	})
+}
+
+func (s *startOp) isCancelled() bool {
+	select {
+	case <-s.cancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// cancellation returns a channel which is closed once the stream is cancelled,
+// so that a stage waiting for something can stop waiting as well
+func (s *startOp) cancellation() <-chan struct{} {
+	return s.cancelled
+}
+
+// setErr keeps the first error reported by stages
+func (s *startOp) setErr(err error) {
+	s.errL.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.errL.Unlock()
 }
 
 func (s *startOp) end() {
 	if s.closed {
 		panic("stream already closed")
 	}
-	s.downStream.begin(len(s.data))
-	for idx := range s.data {
-		s.downStream.accept(s.data[idx])
-		if s.downStream.cancellationRequested() {
+	defer s.src.close()
+	skipSupersededSorts(chainOf(s))
+	fuse(s)
+	if len(s.observers) > 0 {
+		observe(s)
+	}
+	s.downStream.begin(s.src.size())
+	// check before reading, so that lazy source stops as soon as possible
+	for !s.downStream.cancellationRequested() && s.getErr() == nil {
+		v, ok := s.src.next()
+		if !ok {
 			break
 		}
+		if bad, isBad := v.(badElement); isBad {
+			s.elementFailed(bad.err)
+			continue
+		}
+		s.downStream.accept(v)
+	}
+	if err := s.src.err(); err != nil {
+		s.setErr(err)
 	}
 	s.downStream.end()
+	if s.strategy != nil {
+		if err := s.strategy.done(); err != nil {
+			s.setErr(err)
+		}
+	}
 }
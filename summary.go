@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Percentile is the value at percentage P of a stream
+type Percentile struct {
+	P     float64
+	Value float64
+}
+
+// Histogram counts values into buckets, Bounds are the inclusive upper bounds of
+// buckets in ascending order, Counts[i] is the count of values in (Bounds[i-1], Bounds[i]]
+// and Overflow is the count of values greater than the last bound
+type Histogram struct {
+	Bounds   []float64
+	Counts   []int
+	Overflow int
+	Count    int
+	Sum      float64
+	Min      float64
+	Max      float64
+}
+
+func compareFloat64(a interface{}, b interface{}) int {
+	x, y := a.(float64), b.(float64)
+	if x < y {
+		return -1
+	}
+	if x > y {
+		return 1
+	}
+	return 0
+}
+
+// checkPercentiles panics if any percentage is out of range [0, 100]
+func checkPercentiles(ps []float64) {
+	for _, p := range ps {
+		if !(p >= 0 && p <= 100) {
+			panic(fmt.Sprintf("percentile %v is out of range [0, 100]", p))
+		}
+	}
+}
+
+// checkBounds panics if histogram bounds are not in ascending order
+func checkBounds(bounds []float64) {
+	if !sort.Float64sAreSorted(bounds) {
+		panic(fmt.Sprintf("histogram bounds %v are not in ascending order", bounds))
+	}
+}
+
+// percentiles computes percentiles of sorted float64 values with linear interpolation
+// between closest ranks, the out param must be *[]Percentile
+func percentiles(ps []float64) ReduceFunc {
+	return func(in []interface{}, out interface{}) error {
+		res := make([]Percentile, len(ps))
+		for idx, p := range ps {
+			res[idx] = Percentile{P: p, Value: math.NaN()}
+			if len(in) == 0 {
+				continue
+			}
+			rank := p / 100 * float64(len(in)-1)
+			lo, hi := int(math.Floor(rank)), int(math.Ceil(rank))
+			low, high := in[lo].(float64), in[hi].(float64)
+			res[idx].Value = low + (high-low)*(rank-float64(lo))
+		}
+		*out.(*[]Percentile) = res
+		return nil
+	}
+}
+
+// histogram counts float64 values into buckets, the out param must be *Histogram
+func histogram(bounds []float64) ReduceFunc {
+	return func(in []interface{}, out interface{}) error {
+		h := Histogram{
+			Bounds: bounds,
+			Counts: make([]int, len(bounds)),
+			Count:  len(in),
+			Min:    math.NaN(),
+			Max:    math.NaN(),
+		}
+		for idx := range in {
+			v := in[idx].(float64)
+			h.Sum += v
+			if idx == 0 || v < h.Min {
+				h.Min = v
+			}
+			if idx == 0 || v > h.Max {
+				h.Max = v
+			}
+			if bucket := sort.SearchFloat64s(bounds, v); bucket < len(bounds) {
+				h.Counts[bucket]++
+			} else {
+				h.Overflow++
+			}
+		}
+		*out.(*Histogram) = h
+		return nil
+	}
+}
+
+// numberMapper adapts a NumberFunc to MapFunc
+func numberMapper(key NumberFunc) MapFunc {
+	return func(v interface{}) interface{} {
+		return key(v)
+	}
+}
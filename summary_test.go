@@ -0,0 +1,86 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestPercentiles(t *testing.T) {
+	given := dataGenerator()
+	identity := func(v interface{}) float64 { return float64(v.(int)) }
+	got, err := New(given).Percentiles(identity, 0, 50, 95, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []float64{1, 100.5, 190.05, 200}
+	for idx := range expect {
+		if math.Abs(got[idx].Value-expect[idx]) > 1e-9 {
+			t.Fatalf("expect %v, got %v", expect, got)
+		}
+	}
+	if median, err := Of(3, 1, 2).Median(identity); median != 2 || err != nil {
+		t.Fatalf("expect median 2, got %v, error %v", median, err)
+	}
+	if median, err := Of().Median(identity); !math.IsNaN(median) || err != nil {
+		t.Fatalf("expect NaN median of empty stream, got %v, error %v", median, err)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h, err := Of(1, 5, 10, 11, 100).Histogram(func(v interface{}) float64 {
+		return float64(v.(int))
+	}, []float64{1, 10, 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Count != 5 || h.Overflow != 1 || h.Min != 1 || h.Max != 100 || h.Sum != 127 {
+		t.Fatalf("unexpected histogram %+v", h)
+	}
+	expect := []int{1, 2, 1}
+	for idx := range expect {
+		if h.Counts[idx] != expect[idx] {
+			t.Fatalf("expect counts %v, got %v", expect, h.Counts)
+		}
+	}
+}
+
+func TestSummaryRejectsInvalidArguments(t *testing.T) {
+	identity := func(v interface{}) float64 { return float64(v.(int)) }
+	cases := map[string]func(){
+		"percentile":     func() { Of(1, 2).Percentiles(identity, 50, 101) },
+		"NaN percentile": func() { Of(1, 2).Percentiles(identity, math.NaN()) },
+		"bounds":         func() { Of(1, 2).Histogram(identity, []float64{10, 1}) },
+	}
+	for name, fn := range cases {
+		func() {
+			defer func() {
+				if p := recover(); p == nil {
+					t.Fatalf("%s: expect panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestSummaryReturnsErrorOfStream(t *testing.T) {
+	identity := func(v interface{}) float64 { return float64(v.(int)) }
+	failing := func() Stream {
+		return Of(1, 2, 3).MapWithRetry(func(v interface{}) (interface{}, error) {
+			if v.(int) == 2 {
+				return nil, errFlaky
+			}
+			return v, nil
+		}, RetryPolicy{})
+	}
+	if _, err := failing().Percentiles(identity, 50); !errors.Is(err, errFlaky) {
+		t.Fatalf("expect error of Percentiles, got %v", err)
+	}
+	if _, err := failing().Median(identity); !errors.Is(err, errFlaky) {
+		t.Fatalf("expect error of Median, got %v", err)
+	}
+	if _, err := failing().Histogram(identity, []float64{1}); !errors.Is(err, errFlaky) {
+		t.Fatalf("expect error of Histogram, got %v", err)
+	}
+}
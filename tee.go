@@ -0,0 +1,170 @@
+package stream
+
+import (
+	"fmt"
+	"sync"
+)
+
+// teeBufferSize is the channel buffer of each Tee branch
+const teeBufferSize = 64
+
+// teeOp sends every element it receives to all of its branches. Upstream starts
+// only after every branch has started its terminal operation, and stops once
+// all branches are done
+type teeOp struct {
+	baseStage
+	branches  []*teeBranch
+	l         sync.Mutex
+	started   int
+	closeOnce sync.Once
+	finished  chan struct{} // closed when upstream returns
+}
+
+func (t *teeOp) init(n int) {
+	t.finished = make(chan struct{})
+	t.branches = make([]*teeBranch, n)
+	for idx := range t.branches {
+		t.branches[idx] = &teeBranch{tee: t, ch: make(chan interface{}, teeBufferSize), done: make(chan struct{})}
+	}
+}
+
+func (t *teeOp) streams() []Stream {
+	streams := make([]Stream, len(t.branches))
+	for idx := range t.branches {
+		streams[idx] = newStream(t.branches[idx])
+	}
+	return streams
+}
+
+// branchStarted runs upstream on a new goroutine once all branches are started
+func (t *teeOp) branchStarted() {
+	t.l.Lock()
+	t.started++
+	ready := t.started == len(t.branches)
+	t.l.Unlock()
+	if ready {
+		go t.run()
+	}
+}
+
+func (t *teeOp) run() {
+	defer close(t.finished)
+	defer func() {
+		if r := recover(); r != nil {
+			t.fail(fmt.Errorf("stream panicked: %v", r))
+			t.closeBranches()
+		}
+	}()
+	t.startStage.end()
+}
+
+func (t *teeOp) closeBranches() {
+	t.closeOnce.Do(func() {
+		for _, branch := range t.branches {
+			close(branch.ch)
+		}
+	})
+}
+
+func (t *teeOp) begin(_ int) {}
+
+func (t *teeOp) accept(v interface{}) {
+	for _, branch := range t.branches {
+		select {
+		case branch.ch <- v:
+		case <-branch.done:
+		}
+	}
+}
+
+func (t *teeOp) cancellationRequested() bool {
+	for _, branch := range t.branches {
+		select {
+		case <-branch.done:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (t *teeOp) end() {
+	t.startStage.closed = true
+	t.closeBranches()
+}
+
+// teeBranch is the source of a Stream returned by Tee
+type teeBranch struct {
+	tee       *teeOp
+	ch        chan interface{}
+	done      chan struct{}
+	startOnce sync.Once
+	doneOnce  sync.Once
+}
+
+func (b *teeBranch) start() {
+	b.startOnce.Do(b.tee.branchStarted)
+}
+
+func (b *teeBranch) size() int {
+	return 0
+}
+
+// characteristics of a branch are the ones of data tee receives, but it is not sized
+// since the branch may be cancelled
+func (b *teeBranch) characteristics() Characteristics {
+	return b.tee.node.input &^ Sized
+}
+
+func (b *teeBranch) next() (interface{}, bool) {
+	b.start()
+	v, ok := <-b.ch
+	return v, ok
+}
+
+// err reports the error of upstream
+func (b *teeBranch) err() error {
+	return b.tee.Err()
+}
+
+// close marks the branch done, so that upstream stops sending data to it.
+// The last branch done waits for upstream to return
+func (b *teeBranch) close() {
+	b.start()
+	b.doneOnce.Do(func() {
+		close(b.done)
+	})
+	if b.tee.cancellationRequested() {
+		<-b.tee.finished
+	}
+}
+
+// Broadcast sends data of s to all consumers in one traversal, each consumer receives
+// a Stream on its own goroutine and should call a terminal operation on it. Broadcast
+// returns after all consumers and s return, with the error of s. A panic of any consumer is
+// raised again on the calling goroutine
+func Broadcast(s Stream, consumers ...func(Stream)) error {
+	branches := s.Tee(len(consumers))
+	var wg sync.WaitGroup
+	var l sync.Mutex
+	var panicked interface{}
+	for idx := range consumers {
+		wg.Add(1)
+		go func(consumer func(Stream), branch Stream) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					l.Lock()
+					panicked = r
+					l.Unlock()
+				}
+			}()
+			consumer(branch)
+		}(consumers[idx], branches[idx])
+	}
+	wg.Wait()
+	if panicked != nil {
+		panic(panicked)
+	}
+	return s.Err()
+}
@@ -0,0 +1,56 @@
+package stream
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBroadcast(t *testing.T) {
+	var traversed int32
+	s := New(dataGenerator()).Map(func(v interface{}) interface{} {
+		atomic.AddInt32(&traversed, 1)
+		return v
+	})
+	var count, sum int
+	var limited, sample []interface{}
+	err := Broadcast(s, func(s Stream) {
+		count = s.Count()
+	}, func(s Stream) {
+		s.ForEach(func(v interface{}) {
+			sum += v.(int)
+		})
+	}, func(s Stream) {
+		limited = s.Limit(3).Collect()
+	}, func(s Stream) {
+		sample = s.Sample(5, rand.New(rand.NewSource(1))).Collect()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 200 || sum != 20100 || len(limited) != 3 || len(sample) != 5 {
+		t.Fatalf("unexpected results count %d sum %d limited %v sample %v", count, sum, limited, sample)
+	}
+	if traversed != 200 {
+		t.Fatalf("expect one traversal, %d elements mapped", traversed)
+	}
+}
+
+func TestTeeStopsWhenAllBranchesDone(t *testing.T) {
+	var traversed int32
+	branches := New(dataGenerator()).Map(func(v interface{}) interface{} {
+		atomic.AddInt32(&traversed, 1)
+		return v
+	}).Tee(2)
+	done := make(chan interface{})
+	go func() {
+		done <- branches[0].First()
+	}()
+	second := branches[1].Limit(2).Collect()
+	if first := <-done; first != 1 || len(second) != 2 {
+		t.Fatalf("unexpected results %v %v", first, second)
+	}
+	if atomic.LoadInt32(&traversed) > 2+teeBufferSize {
+		t.Fatalf("upstream should stop when all branches are done, %d elements mapped", traversed)
+	}
+}
@@ -1,5 +1,7 @@
 package stream
 
+import "sync"
+
 // the basic struct of a terminal operation
 // each Stream ends with a terminal operation
 // and all the operations in Stream will not be performed before
@@ -18,6 +20,12 @@ type collectOp struct {
 	data []interface{}
 }
 
+func (c *collectOp) begin(size int) {
+	if size > 0 && c.sizeExact() {
+		c.data = make([]interface{}, 0, size)
+	}
+}
+
 func (c *collectOp) accept(t interface{}) {
 	c.data = append(c.data, t)
 }
@@ -107,3 +115,120 @@ func (i *reduceOp) accept(v interface{}) {
 func (i *reduceOp) end() {
 	i.err = i.reduceFunc(i.received, i.out)
 }
+
+// approxDistinctOp keeps a sketch per shard, which are merged into sketch at end
+type approxDistinctOp struct {
+	terminalOp
+	precision int
+	locks     []sync.Mutex
+	shards    []*hyperLogLog
+	rr        roundRobin
+	sketch    *hyperLogLog
+}
+
+func (a *approxDistinctOp) begin(_ int) {
+	a.locks = make([]sync.Mutex, a.shardCount())
+	a.shards = make([]*hyperLogLog, len(a.locks))
+	for idx := range a.shards {
+		a.shards[idx] = newHyperLogLog(a.precision)
+	}
+}
+
+func (a *approxDistinctOp) accept(v interface{}) {
+	idx := a.rr.next(len(a.shards))
+	a.locks[idx].Lock()
+	a.shards[idx].add(v)
+	a.locks[idx].Unlock()
+}
+
+func (a *approxDistinctOp) end() {
+	a.terminalOp.end()
+	a.sketch = a.shards[0]
+	for idx := 1; idx < len(a.shards); idx++ {
+		a.sketch.merge(a.shards[idx])
+	}
+	a.shards = nil
+}
+
+// approxQuantilesOp keeps a sketch per shard, which are merged into sketch at end
+type approxQuantilesOp struct {
+	terminalOp
+	l      sync.Mutex
+	locks  []sync.Mutex
+	shards []*kllSketch
+	rr     roundRobin
+	sketch *kllSketch
+	failed bool
+}
+
+func (a *approxQuantilesOp) begin(_ int) {
+	a.locks = make([]sync.Mutex, a.shardCount())
+	a.shards = make([]*kllSketch, len(a.locks))
+	for idx := range a.shards {
+		a.shards[idx] = newKLLSketch(kllDefaultK)
+	}
+}
+
+func (a *approxQuantilesOp) accept(v interface{}) {
+	f, err := toFloat64(v)
+	if err != nil {
+		a.l.Lock()
+		a.failed = true
+		a.l.Unlock()
+		a.fail(err)
+		return
+	}
+	idx := a.rr.next(len(a.shards))
+	a.locks[idx].Lock()
+	a.shards[idx].add(f)
+	a.locks[idx].Unlock()
+}
+
+func (a *approxQuantilesOp) cancellationRequested() bool {
+	a.l.Lock()
+	defer a.l.Unlock()
+	return a.failed
+}
+
+func (a *approxQuantilesOp) end() {
+	a.terminalOp.end()
+	a.sketch = a.shards[0]
+	for idx := 1; idx < len(a.shards); idx++ {
+		a.sketch.merge(a.shards[idx])
+	}
+	a.shards = nil
+}
+
+// approxTopFrequentOp keeps a sketch per shard, which are merged into sketch at end
+type approxTopFrequentOp struct {
+	terminalOp
+	capacity int
+	locks    []sync.Mutex
+	shards   []*spaceSaving
+	rr       roundRobin
+	sketch   *spaceSaving
+}
+
+func (a *approxTopFrequentOp) begin(_ int) {
+	a.locks = make([]sync.Mutex, a.shardCount())
+	a.shards = make([]*spaceSaving, len(a.locks))
+	for idx := range a.shards {
+		a.shards[idx] = newSpaceSaving(a.capacity)
+	}
+}
+
+func (a *approxTopFrequentOp) accept(v interface{}) {
+	idx := a.rr.next(len(a.shards))
+	a.locks[idx].Lock()
+	a.shards[idx].add(v)
+	a.locks[idx].Unlock()
+}
+
+func (a *approxTopFrequentOp) end() {
+	a.terminalOp.end()
+	a.sketch = a.shards[0]
+	for idx := 1; idx < len(a.shards); idx++ {
+		a.sketch.merge(a.shards[idx])
+	}
+	a.shards = nil
+}
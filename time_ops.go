@@ -0,0 +1,234 @@
+package stream
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time used by time based operations, WithClock replaces the
+// system clock of a stream, e.g. with a fake one in tests
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	// AfterFunc calls f on its own goroutine once d elapsed, unless the returned Timer is stopped
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending call created by Clock.AfterFunc
+type Timer interface {
+	// Stop prevents the call from running, it returns false if the call already ran or was stopped
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// sleep waits d on clock, and returns false at once if cancelled is closed before d elapsed.
+// The system clock waits on a timer, Sleep of other clocks runs on its own goroutine, which
+// is left to finish on its own when the wait is cancelled
+func sleep(clock Clock, d time.Duration, cancelled <-chan struct{}) bool {
+	select {
+	case <-cancelled:
+		return false
+	default:
+	}
+	if d <= 0 {
+		return true
+	}
+	if _, ok := clock.(systemClock); ok {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return true
+		case <-cancelled:
+			return false
+		}
+	}
+	slept := make(chan struct{})
+	go func() {
+		clock.Sleep(d)
+		close(slept)
+	}()
+	select {
+	case <-slept:
+		return true
+	case <-cancelled:
+		return false
+	}
+}
+
+// rateLimitOp passes elements at a rate of n per duration using a token bucket,
+// which holds at most n tokens so that a burst of n elements passes at once
+type rateLimitOp struct {
+	baseStage
+	n      int
+	per    time.Duration
+	clock  Clock
+	l      sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// rate is the count of tokens added per nanosecond
+func (r *rateLimitOp) rate() float64 {
+	return float64(r.n) / float64(r.per)
+}
+
+func (r *rateLimitOp) refill() {
+	now := r.clock.Now()
+	r.tokens = math.Min(float64(r.n), r.tokens+float64(now.Sub(r.last))*r.rate())
+	r.last = now
+}
+
+func (r *rateLimitOp) begin(size int) {
+	r.clock = r.startStage.getClock()
+	r.tokens = float64(r.n)
+	r.last = r.clock.Now()
+	r.downStream.begin(size)
+}
+
+// accept takes a token, the count of tokens goes negative if there are not enough, so that
+// parallel callers reserve their turns in order and wait for them without holding the lock
+func (r *rateLimitOp) accept(t interface{}) {
+	r.l.Lock()
+	r.refill()
+	r.tokens--
+	var wait time.Duration
+	if r.tokens < 0 {
+		wait = time.Duration(math.Ceil(-r.tokens / r.rate()))
+	}
+	r.l.Unlock()
+	if sleep(r.clock, wait, r.startStage.cancellation()) && !r.stopRequested() {
+		r.downStream.accept(t)
+	}
+}
+
+func (r *rateLimitOp) cancellationRequested() bool {
+	return r.stopRequested()
+}
+
+// throttleOp passes the first element of every interval and drops the others
+type throttleOp struct {
+	baseStage
+	interval time.Duration
+	clock    Clock
+	l        sync.Mutex
+	passed   bool
+	last     time.Time
+}
+
+func (t *throttleOp) begin(size int) {
+	t.clock = t.startStage.getClock()
+	t.downStream.begin(size)
+}
+
+func (t *throttleOp) accept(v interface{}) {
+	t.l.Lock()
+	now := t.clock.Now()
+	pass := !t.passed || now.Sub(t.last) >= t.interval
+	if pass {
+		t.passed, t.last = true, now
+	}
+	t.l.Unlock()
+	if pass && !t.stopRequested() {
+		t.downStream.accept(v)
+	}
+}
+
+func (t *throttleOp) cancellationRequested() bool {
+	return t.stopRequested()
+}
+
+// debounceOp passes an element only if no other element follows it in quiet duration,
+// the pending element is passed by a timer of clock, or by end if the stream is done
+type debounceOp struct {
+	statefulOp
+	quiet      time.Duration
+	clock      Clock
+	pending    interface{}
+	hasPending bool
+	timer      Timer
+	seq        int // identifies the latest timer, timers replaced by later ones do nothing
+	ended      bool
+}
+
+func (d *debounceOp) begin(size int) {
+	d.clock = d.startStage.getClock()
+	d.downStream.begin(size)
+}
+
+func (d *debounceOp) accept(t interface{}) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.pending, d.hasPending = t, true
+	d.seq++
+	seq := d.seq
+	d.timer = d.clock.AfterFunc(d.quiet, func() {
+		d.l.Lock()
+		defer d.l.Unlock()
+		if seq == d.seq && !d.ended {
+			d.flush()
+		}
+	})
+}
+
+// flush passes the pending element, it should be called with lock held
+func (d *debounceOp) flush() {
+	if d.hasPending && !d.stopRequested() {
+		d.downStream.accept(d.pending)
+	}
+	d.pending, d.hasPending = nil, false
+}
+
+func (d *debounceOp) cancellationRequested() bool {
+	return d.stopRequested()
+}
+
+func (d *debounceOp) end() {
+	d.l.Lock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.flush()
+	d.ended = true
+	d.l.Unlock()
+	d.downStream.end()
+}
+
+// delayOp pauses before passing each element
+type delayOp struct {
+	baseStage
+	delay time.Duration
+	clock Clock
+}
+
+func (d *delayOp) begin(size int) {
+	d.clock = d.startStage.getClock()
+	d.downStream.begin(size)
+}
+
+func (d *delayOp) accept(t interface{}) {
+	if sleep(d.clock, d.delay, d.startStage.cancellation()) && !d.stopRequested() {
+		d.downStream.accept(t)
+	}
+}
+
+func (d *delayOp) cancellationRequested() bool {
+	return d.stopRequested()
+}
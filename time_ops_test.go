@@ -0,0 +1,240 @@
+package stream
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when Sleep or Advance is called, timers due are run
+// synchronously by the caller which moves the clock
+type fakeClock struct {
+	l      sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	f     func()
+	done  bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.l.Lock()
+	defer c.l.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, it stops at each timer due to run it
+func (c *fakeClock) Advance(d time.Duration) {
+	c.l.Lock()
+	target := c.now.Add(d)
+	for {
+		var next *fakeTimer
+		for _, t := range c.timers {
+			if !t.done && !t.at.After(target) && (next == nil || t.at.Before(next.at)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		next.done = true
+		if next.at.After(c.now) {
+			c.now = next.at
+		}
+		c.l.Unlock()
+		next.f()
+		c.l.Lock()
+	}
+	c.now = target
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.done {
+			pending = append(pending, t)
+		}
+	}
+	c.timers = pending
+	c.l.Unlock()
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.l.Lock()
+	defer t.clock.l.Unlock()
+	stopped := !t.done
+	t.done = true
+	return stopped
+}
+
+// sleepBefore sleeps the duration of gaps for each element before passing it
+func sleepBefore(c Clock, gaps map[interface{}]time.Duration) MapFunc {
+	return func(v interface{}) interface{} {
+		c.Sleep(gaps[v])
+		return v
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	c := newFakeClock()
+	start := c.Now()
+	elapsed := make([]time.Duration, 0)
+	Of(1, 2, 3, 4, 5, 6).WithClock(c).RateLimit(2, time.Second).ForEach(func(_ interface{}) {
+		elapsed = append(elapsed, c.Now().Sub(start))
+	})
+	expect := []time.Duration{0, 0, 500 * time.Millisecond, time.Second, 1500 * time.Millisecond, 2 * time.Second}
+	for idx := range expect {
+		if diff := elapsed[idx] - expect[idx]; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Fatalf("expect elements passed at %v, got %v", expect, elapsed)
+		}
+	}
+
+	c = newFakeClock()
+	if got := Of(1, 2, 3).WithClock(c).RateLimit(1, time.Hour).Limit(1).Count(); got != 1 {
+		t.Fatalf("expect 1 element, got %d", got)
+	}
+	if !c.Now().Equal(start) {
+		t.Fatalf("expect no wait after cancellation, waited %v", c.Now().Sub(start))
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	c := newFakeClock()
+	gaps := make(map[interface{}]time.Duration)
+	for idx := 1; idx <= 10; idx++ {
+		gaps[idx] = 300 * time.Millisecond
+	}
+	got := Of(1, 2, 3, 4, 5, 6, 7, 8, 9, 10).WithClock(c).Map(sleepBefore(c, gaps)).Throttle(time.Second).Collect()
+	if !reflect.DeepEqual(got, []interface{}{1, 5, 9}) {
+		t.Fatalf("unexpected result %v", got)
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	c := newFakeClock()
+	gaps := map[interface{}]time.Duration{
+		2: 100 * time.Millisecond,
+		3: 100 * time.Millisecond,
+		4: 500 * time.Millisecond,
+		5: 100 * time.Millisecond,
+		6: 500 * time.Millisecond,
+	}
+	got := Of(1, 2, 3, 4, 5, 6).WithClock(c).Map(sleepBefore(c, gaps)).Debounce(300 * time.Millisecond).Collect()
+	if !reflect.DeepEqual(got, []interface{}{3, 5, 6}) {
+		t.Fatalf("unexpected result %v", got)
+	}
+	if got := Of().WithClock(c).Debounce(time.Second).Count(); got != 0 {
+		t.Fatalf("expect empty result, got %d", got)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	c := newFakeClock()
+	start := c.Now()
+	s := Of(1, 2, 3).WithClock(c).Delay(time.Second)
+	if !strings.Contains(s.Explain(), "1. Delay(1s) stateless [sized ordered nonnull]") {
+		t.Fatalf("unexpected plan:\n%s", s.Explain())
+	}
+	if got := s.Count(); got != 3 {
+		t.Fatalf("expect 3 elements, got %d", got)
+	}
+	if elapsed := c.Now().Sub(start); elapsed != 3*time.Second {
+		t.Fatalf("expect 3s elapsed, got %v", elapsed)
+	}
+}
+
+func TestWithClockReturnsStage(t *testing.T) {
+	c := newFakeClock()
+	s := Of(1, 2, 3).Delay(time.Second)
+	clocked := s.WithClock(c)
+	if clocked != s {
+		t.Fatalf("expect the Delay stage returned, got %T", clocked)
+	}
+	if got := clocked.Count(); got != 3 || c.Now().Sub(time.Unix(0, 0)) != 3*time.Second {
+		t.Fatalf("expect 3 elements delayed by fake clock, got %d", got)
+	}
+}
+
+func TestSystemClock(t *testing.T) {
+	start := time.Now()
+	if got := Of(1, 2).Delay(time.Millisecond).Count(); got != 2 {
+		t.Fatalf("expect 2 elements, got %d", got)
+	}
+	if time.Since(start) < 2*time.Millisecond {
+		t.Fatal("expect elements delayed by system clock")
+	}
+}
+
+func TestTimeOpsRejectNonPositiveDurations(t *testing.T) {
+	cases := map[string]func(){
+		"throttle": func() { Of(1).Throttle(0) },
+		"debounce": func() { Of(1).Debounce(-time.Second) },
+		"delay":    func() { Of(1).Delay(0) },
+	}
+	for name, build := range cases {
+		func() {
+			defer func() {
+				if p := recover(); p == nil {
+					t.Errorf("%s: expect panic when the stage is built", name)
+				}
+			}()
+			build()
+		}()
+	}
+}
+
+func TestTimeOpsWaitsStopOnCancel(t *testing.T) {
+	for name, s := range map[string]Stream{
+		"delay":      Of(1, 2).Delay(time.Hour),
+		"rate limit": Of(1, 2).RateLimit(1, time.Hour),
+	} {
+		f := s.Async().Count()
+		time.Sleep(10 * time.Millisecond)
+		f.Cancel()
+		select {
+		case <-f.Done():
+			if !errors.Is(f.Err(), ErrCancelled) {
+				t.Errorf("%s: expect ErrCancelled, got %v", name, f.Err())
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: expect the wait stopped by cancel", name)
+		}
+	}
+}
+
+func TestRateLimitDoesNotWaitHoldingLock(t *testing.T) {
+	c := &stuckClock{fakeClock: newFakeClock(), sleeping: make(chan struct{}, 1), wake: make(chan struct{})}
+	s := Of(1, 2).WithClock(c).RateLimit(1, time.Second)
+	done := make(chan int)
+	go func() {
+		done <- s.Count()
+	}()
+	<-c.sleeping
+	op := s.(*rateLimitOp)
+	op.l.Lock() // the element waiting for its token does not hold the lock
+	op.l.Unlock()
+	close(c.wake)
+	if got := <-done; got != 2 {
+		t.Fatalf("expect 2 elements, got %d", got)
+	}
+}
@@ -0,0 +1,236 @@
+package stream
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// WindowOptions configures time windows
+type WindowOptions struct {
+	// Timestamp extracts the event time of element, the time of stream clock when an element
+	// arrives is used if it is nil, and windows are also closed by timers of clock in that case
+	Timestamp TimestampFunc
+	// AllowedLateness is how long a window stays open after the watermark, which is the latest
+	// timestamp seen, passed its end. Elements of a closed window are dropped
+	AllowedLateness time.Duration
+}
+
+// Window is the element emitted by time windows, it holds elements whose timestamp
+// is in [Start, End), in the order they arrived
+type Window struct {
+	Start    time.Time
+	End      time.Time
+	Elements []interface{}
+}
+
+type windowKind int
+
+const (
+	slidingWindow windowKind = iota // a tumbling window is a sliding one whose slide equals size
+	sessionWindow
+)
+
+// windowOp groups elements into time windows, windows are passed to next stage in the
+// order of their start once the watermark passed their end plus allowed lateness,
+// windows still open are passed when the stream is done
+type windowOp struct {
+	statefulOp
+	kind      windowKind
+	size      time.Duration // the gap between sessions for session windows
+	slide     time.Duration
+	opts      WindowOptions
+	clock     Clock
+	open      []*Window
+	watermark time.Time
+	timers    map[*Window]Timer // timers closing open windows
+	arrivals  map[*Window][]int // arrival indexes of elements in open sessions, to merge them in order
+	arrived   int
+	ended     bool
+}
+
+func (w *windowOp) describe(node *planNode) {
+	switch {
+	case w.kind == sessionWindow:
+		node.params = fmt.Sprintf("gap=%v", w.size)
+	case w.size == w.slide:
+		node.params = fmt.Sprintf("size=%v", w.size)
+	default:
+		node.params = fmt.Sprintf("size=%v, slide=%v", w.size, w.slide)
+	}
+	if w.opts.AllowedLateness > 0 {
+		node.params += fmt.Sprintf(", lateness=%v", w.opts.AllowedLateness)
+	}
+}
+
+func (w *windowOp) begin(_ int) {
+	w.clock = w.startStage.getClock()
+	w.timers = make(map[*Window]Timer)
+	w.arrivals = make(map[*Window][]int)
+	w.downStream.begin(0)
+}
+
+func (w *windowOp) accept(t interface{}) {
+	w.l.Lock()
+	defer w.l.Unlock()
+	var ts time.Time
+	if w.opts.Timestamp != nil {
+		ts = w.opts.Timestamp(t)
+	} else {
+		ts = w.clock.Now()
+	}
+	if w.kind == sessionWindow {
+		w.assignSession(t, ts)
+	} else {
+		w.assignSliding(t, ts)
+	}
+	w.advance(ts)
+}
+
+// closed reports whether a window ends at end is closed by watermark
+func (w *windowOp) closed(end time.Time) bool {
+	return !end.Add(w.opts.AllowedLateness).After(w.watermark)
+}
+
+// add creates a new open window, it is closed by a timer if elements are timed by clock
+func (w *windowOp) add(win *Window) {
+	w.open = append(w.open, win)
+	if w.opts.Timestamp != nil {
+		return
+	}
+	w.timers[win] = w.clock.AfterFunc(win.End.Add(w.opts.AllowedLateness).Sub(w.clock.Now()), func() {
+		w.l.Lock()
+		defer w.l.Unlock()
+		if !w.ended {
+			w.advance(w.clock.Now())
+		}
+	})
+}
+
+// remove stops the timer of a window which is no longer open
+func (w *windowOp) remove(win *Window) {
+	if timer, ok := w.timers[win]; ok {
+		timer.Stop()
+		delete(w.timers, win)
+	}
+	delete(w.arrivals, win)
+}
+
+// assignSliding adds element to every window covers ts, windows are aligned to the zero Unix time
+func (w *windowOp) assignSliding(t interface{}, ts time.Time) {
+	nanos, slide := ts.UnixNano(), int64(w.slide)
+	last := nanos - nanos%slide
+	if nanos%slide < 0 {
+		last -= slide
+	}
+	for start := last; start+int64(w.size) > nanos; start -= slide {
+		end := time.Unix(0, start+int64(w.size))
+		if w.closed(end) {
+			continue // late element
+		}
+		var win *Window
+		for _, open := range w.open {
+			if open.Start.UnixNano() == start {
+				win = open
+				break
+			}
+		}
+		if win == nil {
+			win = &Window{Start: time.Unix(0, start), End: end}
+			w.add(win)
+		}
+		win.Elements = append(win.Elements, t)
+	}
+}
+
+// assignSession merges the session [ts, ts+gap) with all the open sessions overlap with it,
+// elements of the merged session stay in the order they arrived
+func (w *windowOp) assignSession(t interface{}, ts time.Time) {
+	merged := &Window{Start: ts, End: ts.Add(w.size), Elements: []interface{}{t}}
+	if w.closed(merged.End) {
+		return // late element
+	}
+	arrivals := []int{w.arrived}
+	w.arrived++
+	open := w.open[:0]
+	for _, win := range w.open {
+		if win.Start.Before(merged.End) && merged.Start.Before(win.End) {
+			if win.Start.Before(merged.Start) {
+				merged.Start = win.Start
+			}
+			if win.End.After(merged.End) {
+				merged.End = win.End
+			}
+			merged.Elements, arrivals = mergeArrivals(win.Elements, w.arrivals[win], merged.Elements, arrivals)
+			w.remove(win)
+		} else {
+			open = append(open, win)
+		}
+	}
+	w.open = open
+	w.add(merged)
+	w.arrivals[merged] = arrivals
+}
+
+// mergeArrivals merges elements of two sessions by their arrival indexes
+func mergeArrivals(left []interface{}, leftArrivals []int, right []interface{}, rightArrivals []int) ([]interface{}, []int) {
+	elements := make([]interface{}, 0, len(left)+len(right))
+	arrivals := make([]int, 0, len(left)+len(right))
+	for len(left) > 0 || len(right) > 0 {
+		if len(right) == 0 || (len(left) > 0 && leftArrivals[0] < rightArrivals[0]) {
+			elements, arrivals = append(elements, left[0]), append(arrivals, leftArrivals[0])
+			left, leftArrivals = left[1:], leftArrivals[1:]
+		} else {
+			elements, arrivals = append(elements, right[0]), append(arrivals, rightArrivals[0])
+			right, rightArrivals = right[1:], rightArrivals[1:]
+		}
+	}
+	return elements, arrivals
+}
+
+// advance moves watermark to ts, and passes the windows it closed
+func (w *windowOp) advance(ts time.Time) {
+	if ts.After(w.watermark) {
+		w.watermark = ts
+	}
+	closed := make([]*Window, 0)
+	open := w.open[:0]
+	for _, win := range w.open {
+		if w.closed(win.End) {
+			closed = append(closed, win)
+			w.remove(win)
+		} else {
+			open = append(open, win)
+		}
+	}
+	w.open = open
+	w.emit(closed)
+}
+
+func (w *windowOp) emit(windows []*Window) {
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].Start.Before(windows[j].Start)
+	})
+	for _, win := range windows {
+		if w.stopRequested() {
+			return
+		}
+		w.downStream.accept(*win)
+	}
+}
+
+func (w *windowOp) cancellationRequested() bool {
+	return w.stopRequested()
+}
+
+func (w *windowOp) end() {
+	w.l.Lock()
+	w.ended = true
+	for _, win := range w.open {
+		w.remove(win)
+	}
+	w.emit(w.open)
+	w.open = nil
+	w.l.Unlock()
+	w.downStream.end()
+}
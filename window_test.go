@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type timedEvent struct {
+	v  int
+	at int // seconds since zero Unix time
+}
+
+func eventTime(v interface{}) time.Time {
+	return time.Unix(int64(v.(timedEvent).at), 0)
+}
+
+// windowsOf turns windows into start and end seconds with values of events
+func windowsOf(windows []interface{}) [][]int {
+	res := make([][]int, 0, len(windows))
+	for _, w := range windows {
+		win := w.(Window)
+		values := []int{int(win.Start.Unix()), int(win.End.Unix())}
+		for _, e := range win.Elements {
+			values = append(values, e.(timedEvent).v)
+		}
+		res = append(res, values)
+	}
+	return res
+}
+
+func eventsAt(seconds ...int) Stream {
+	events := make([]interface{}, 0, len(seconds))
+	for idx, at := range seconds {
+		events = append(events, timedEvent{v: idx + 1, at: at})
+	}
+	return New(events)
+}
+
+func TestTumblingWindow(t *testing.T) {
+	got := eventsAt(1, 2, 5, 11, 12, 25).TumblingWindow(10*time.Second, WindowOptions{Timestamp: eventTime}).Collect()
+	expect := [][]int{{0, 10, 1, 2, 3}, {10, 20, 4, 5}, {20, 30, 6}}
+	if !reflect.DeepEqual(windowsOf(got), expect) {
+		t.Fatalf("expect %v, got %v", expect, windowsOf(got))
+	}
+}
+
+func TestWindowLateness(t *testing.T) {
+	got := eventsAt(1, 12, 3).TumblingWindow(10*time.Second, WindowOptions{Timestamp: eventTime}).Collect()
+	expect := [][]int{{0, 10, 1}, {10, 20, 2}}
+	if !reflect.DeepEqual(windowsOf(got), expect) {
+		t.Fatalf("expect late element dropped %v, got %v", expect, windowsOf(got))
+	}
+
+	s := eventsAt(1, 12, 3, 16, 4).TumblingWindow(10*time.Second, WindowOptions{
+		Timestamp:       eventTime,
+		AllowedLateness: 5 * time.Second,
+	})
+	got = s.Collect()
+	expect = [][]int{{0, 10, 1, 3}, {10, 20, 2, 4}}
+	if !reflect.DeepEqual(windowsOf(got), expect) {
+		t.Fatalf("expect late element accepted in lateness %v, got %v", expect, windowsOf(got))
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	got := eventsAt(7, 12).SlidingWindow(10*time.Second, 5*time.Second, WindowOptions{Timestamp: eventTime}).Collect()
+	expect := [][]int{{0, 10, 1}, {5, 15, 1, 2}, {10, 20, 2}}
+	if !reflect.DeepEqual(windowsOf(got), expect) {
+		t.Fatalf("expect %v, got %v", expect, windowsOf(got))
+	}
+}
+
+func TestSessionWindow(t *testing.T) {
+	s := eventsAt(1, 3, 10, 7, 30).SessionWindow(5*time.Second, WindowOptions{Timestamp: eventTime, AllowedLateness: time.Second})
+	if !strings.Contains(s.Explain(), "1. SessionWindow(gap=5s, lateness=1s) stateful [ordered nonnull]") {
+		t.Fatalf("unexpected plan:\n%s", s.Explain())
+	}
+	got := s.Collect()
+	expect := [][]int{{1, 8, 1, 2}, {7, 15, 3, 4}, {30, 35, 5}}
+	if !reflect.DeepEqual(windowsOf(got), expect) {
+		t.Fatalf("expect %v, got %v", expect, windowsOf(got))
+	}
+}
+
+func TestSessionWindowMergeOrder(t *testing.T) {
+	// three sessions opened out of order, the late element at 5 bridges the first two,
+	// and the one at 15 bridges the result with the third
+	got := eventsAt(10, 1, 20, 5, 15).SessionWindow(6*time.Second, WindowOptions{Timestamp: eventTime, AllowedLateness: time.Minute}).Collect()
+	expect := [][]int{{1, 26, 1, 2, 3, 4, 5}}
+	if !reflect.DeepEqual(windowsOf(got), expect) {
+		t.Fatalf("expect %v, got %v", expect, windowsOf(got))
+	}
+}
+
+func TestProcessingTimeWindow(t *testing.T) {
+	c := newFakeClock()
+	gaps := map[interface{}]time.Duration{
+		1: 200 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 1100 * time.Millisecond,
+		4: 2000 * time.Millisecond,
+	}
+	emitted := make([]time.Duration, 0)
+	windows := make([]interface{}, 0)
+	Of(1, 2, 3, 4).WithClock(c).Map(sleepBefore(c, gaps)).Map(func(v interface{}) interface{} {
+		return timedEvent{v: v.(int)}
+	}).TumblingWindow(time.Second, WindowOptions{}).ForEach(func(w interface{}) {
+		emitted = append(emitted, c.Now().Sub(time.Unix(0, 0)))
+		windows = append(windows, w)
+	})
+	expect := [][]int{{0, 1, 1, 2}, {1, 2, 3}, {3, 4, 4}}
+	if !reflect.DeepEqual(windowsOf(windows), expect) {
+		t.Fatalf("expect %v, got %v", expect, windowsOf(windows))
+	}
+	// the second window is closed by timer while source is idle, the last one by end of stream
+	if emitted[1] != 2*time.Second || emitted[2] != 3500*time.Millisecond {
+		t.Fatalf("unexpected emitted time %v", emitted)
+	}
+}